@@ -13,6 +13,7 @@ type AppConfig struct {
 	DB      *database.DatabaseManager
 	Storage storage.StorageService
 	Env     *Env
+	Ladder  []LadderRung
 }
 
 func LoadConfig() *AppConfig {
@@ -22,6 +23,29 @@ func LoadConfig() *AppConfig {
 		log.Fatalf("Error loading .env file: %v", err)
 	}
 
+	for _, format := range env.OUTPUT_FORMATS {
+		if format != "hls" && format != "dash" {
+			log.Fatalf("Unsupported output format %q, use hls and/or dash", format)
+		}
+	}
+	if len(env.OUTPUT_FORMATS) == 0 {
+		log.Fatalf("OUTPUT_FORMATS must enable hls and/or dash")
+	}
+	if env.HLS_SEGMENT_TYPE != "mpegts" && env.HLS_SEGMENT_TYPE != "fmp4" {
+		log.Fatalf("Unsupported HLS segment type %q, use mpegts or fmp4", env.HLS_SEGMENT_TYPE)
+	}
+	if env.HLS_ENCRYPTION != "none" && env.HLS_ENCRYPTION != "aes-128" {
+		log.Fatalf("Unsupported HLS encryption %q, use none or aes-128", env.HLS_ENCRYPTION)
+	}
+	// DASH players expect CENC, they cannot decrypt whole AES-128 segments
+	if env.HLS_ENCRYPTION != "none" && env.OutputEnabled("dash") {
+		log.Fatalf("HLS_ENCRYPTION cannot be combined with the dash output format")
+	}
+
+	if env.PER_TITLE_CRF < 0 || env.PER_TITLE_CRF > 51 {
+		log.Fatalf("PER_TITLE_CRF must be between 0 and 51, got %d", env.PER_TITLE_CRF)
+	}
+
 	dbConnString := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
 		env.DB_USER, env.DB_PASS, env.DB_HOST, env.DB_PORT, env.DB_NAME, env.DB_SSLMODE,
 	)
@@ -32,11 +56,12 @@ func LoadConfig() *AppConfig {
 	}
 
 	swiftCfg := storage.SwiftCfg{
-		SWIFT_USERNAME:  env.SWIFT_USERNAME,
-		SWIFT_API_KEY:   env.SWIFT_API_KEY,
-		SWIFT_AUTH_URL:  env.SWIFT_AUTH_URL,
-		SWIFT_REGION:    env.SWIFT_REGION,
-		SWIFT_CONTAINER: env.SWIFT_CONTAINER,
+		SWIFT_USERNAME:     env.SWIFT_USERNAME,
+		SWIFT_API_KEY:      env.SWIFT_API_KEY,
+		SWIFT_AUTH_URL:     env.SWIFT_AUTH_URL,
+		SWIFT_REGION:       env.SWIFT_REGION,
+		SWIFT_CONTAINER:    env.SWIFT_CONTAINER,
+		SWIFT_TEMP_URL_KEY: env.SWIFT_TEMP_URL_KEY,
 	}
 	miniCfg := storage.S3Cfg{
 		S3_ENDPOINT:    env.S3_ENDPOINT,
@@ -45,14 +70,31 @@ func LoadConfig() *AppConfig {
 		S3_BUCKET_NAME: env.S3_BUCKET_NAME,
 		S3_IS_HTTPS:    env.S3_IS_HTTPS,
 	}
-	storageSrv, err := storage.NewStorageService(env.STORAGE_PROVIDER, miniCfg, swiftCfg)
+	localCfg := storage.LocalCfg{
+		LOCAL_STORAGE_ROOT: env.LOCAL_STORAGE_ROOT,
+		LOCAL_STORAGE_URL:  env.CDN_URL,
+	}
+	storageSrv, err := storage.NewStorageService(env.STORAGE_PROVIDER, miniCfg, swiftCfg, localCfg)
 	if err != nil {
 		log.Fatalf("Storage initialization failed: %v", err)
 	}
 
+	ladder, err := LoadLadder(env.ENCODING_LADDER_FILE)
+	if err != nil {
+		log.Fatalf("Encoding ladder initialization failed: %v", err)
+	}
+
+	// The hls muxer only writes HEVC and AV1 into fMP4 segments
+	for _, rung := range ladder {
+		if rung.Codec != "h264" && env.HLS_SEGMENT_TYPE != "fmp4" {
+			log.Fatalf("Rung %s uses %s, which needs HLS_SEGMENT_TYPE=fmp4", rung.Name, rung.Codec)
+		}
+	}
+
 	return &AppConfig{
 		DB:      db,
 		Env:     env,
 		Storage: storageSrv,
+		Ladder:  ladder,
 	}
 }
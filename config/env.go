@@ -2,31 +2,55 @@ package config
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Env struct {
-	CDN_URL          string
-	AUTH_URL         string
-	S3_BUCKET_NAME   string
-	S3_ENDPOINT      string
-	S3_ACCESS_KEY    string
-	S3_SECRET_KEY    string
-	S3_IS_HTTPS      bool
-	DB_USER          string
-	DB_PASS          string
-	DB_HOST          string
-	DB_PORT          string
-	DB_NAME          string
-	DB_SSLMODE       string
-	STORAGE_PROVIDER string
-	SWIFT_USERNAME   string
-	SWIFT_API_KEY    string
-	SWIFT_AUTH_URL   string
-	SWIFT_REGION     string
-	SWIFT_CONTAINER  string
+	CDN_URL                 string
+	AUTH_URL                string
+	S3_BUCKET_NAME          string
+	S3_ENDPOINT             string
+	S3_ACCESS_KEY           string
+	S3_SECRET_KEY           string
+	S3_IS_HTTPS             bool
+	DB_USER                 string
+	DB_PASS                 string
+	DB_HOST                 string
+	DB_PORT                 string
+	DB_NAME                 string
+	DB_SSLMODE              string
+	STORAGE_PROVIDER        string
+	SWIFT_USERNAME          string
+	SWIFT_API_KEY           string
+	SWIFT_AUTH_URL          string
+	SWIFT_REGION            string
+	SWIFT_CONTAINER         string
+	LOCAL_STORAGE_ROOT      string
+	SWIFT_TEMP_URL_KEY      string
+	APP_URL                 string
+	SIGNED_URLS             bool
+	SIGNED_URL_TTL          time.Duration
+	TRANSCODE_WORKERS       int
+	TRANSCODE_MAX_ATTEMPTS  int
+	TRANSCODE_RETRY_BACKOFF time.Duration
+	ENCODING_LADDER_FILE    string
+	THUMBNAIL_OFFSET        time.Duration
+	SPRITE_INTERVAL         time.Duration
+	OUTPUT_FORMATS          []string
+	HLS_SEGMENT_TYPE        string
+	HLS_ENCRYPTION          string
+	HLS_KEY_ROTATION        int
+	UPLOAD_CONCURRENCY      int
+	UPLOAD_MAX_ATTEMPTS     int
+	PER_TITLE_ENCODING      bool
+	PER_TITLE_CRF           int
+	OPERATOR_USER_IDS       []string
 }
 
 func LoadEnv() (*Env, error) {
@@ -36,24 +60,108 @@ func LoadEnv() (*Env, error) {
 	}
 
 	return &Env{
-		CDN_URL:          os.Getenv("CDN_URL"),
-		AUTH_URL:         os.Getenv("AUTH_URL"),
-		S3_BUCKET_NAME:   os.Getenv("S3_BUCKET_NAME"),
-		S3_ENDPOINT:      os.Getenv("S3_ENDPOINT"),
-		S3_ACCESS_KEY:    os.Getenv("S3_ACCESS_KEY"),
-		S3_SECRET_KEY:    os.Getenv("S3_SECRET_KEY"),
-		S3_IS_HTTPS:      os.Getenv("S3_IS_HTTPS") == "true",
-		DB_USER:          os.Getenv("DB_USER"),
-		DB_PASS:          os.Getenv("DB_PASS"),
-		DB_HOST:          os.Getenv("DB_HOST"),
-		DB_PORT:          os.Getenv("DB_PORT"),
-		DB_NAME:          os.Getenv("DB_NAME"),
-		DB_SSLMODE:       os.Getenv("DB_SSLMODE"),
-		STORAGE_PROVIDER: os.Getenv("STORAGE_PROVIDER"),
-		SWIFT_USERNAME:   os.Getenv("SWIFT_USERNAME"),
-		SWIFT_API_KEY:    os.Getenv("SWIFT_API_KEY"),
-		SWIFT_AUTH_URL:   os.Getenv("SWIFT_AUTH_URL"),
-		SWIFT_REGION:     os.Getenv("SWIFT_REGION"),
-		SWIFT_CONTAINER:  os.Getenv("SWIFT_CONTAINER"),
+		CDN_URL:                 os.Getenv("CDN_URL"),
+		AUTH_URL:                os.Getenv("AUTH_URL"),
+		S3_BUCKET_NAME:          os.Getenv("S3_BUCKET_NAME"),
+		S3_ENDPOINT:             os.Getenv("S3_ENDPOINT"),
+		S3_ACCESS_KEY:           os.Getenv("S3_ACCESS_KEY"),
+		S3_SECRET_KEY:           os.Getenv("S3_SECRET_KEY"),
+		S3_IS_HTTPS:             os.Getenv("S3_IS_HTTPS") == "true",
+		DB_USER:                 os.Getenv("DB_USER"),
+		DB_PASS:                 os.Getenv("DB_PASS"),
+		DB_HOST:                 os.Getenv("DB_HOST"),
+		DB_PORT:                 os.Getenv("DB_PORT"),
+		DB_NAME:                 os.Getenv("DB_NAME"),
+		DB_SSLMODE:              os.Getenv("DB_SSLMODE"),
+		STORAGE_PROVIDER:        os.Getenv("STORAGE_PROVIDER"),
+		SWIFT_USERNAME:          os.Getenv("SWIFT_USERNAME"),
+		SWIFT_API_KEY:           os.Getenv("SWIFT_API_KEY"),
+		SWIFT_AUTH_URL:          os.Getenv("SWIFT_AUTH_URL"),
+		SWIFT_REGION:            os.Getenv("SWIFT_REGION"),
+		SWIFT_CONTAINER:         os.Getenv("SWIFT_CONTAINER"),
+		LOCAL_STORAGE_ROOT:      getEnvDefault("LOCAL_STORAGE_ROOT", "storage"),
+		SWIFT_TEMP_URL_KEY:      os.Getenv("SWIFT_TEMP_URL_KEY"),
+		APP_URL:                 os.Getenv("APP_URL"),
+		SIGNED_URLS:             os.Getenv("SIGNED_URLS") == "true",
+		SIGNED_URL_TTL:          getEnvDuration("SIGNED_URL_TTL", time.Hour),
+		TRANSCODE_WORKERS:       getEnvInt("TRANSCODE_WORKERS", 2),
+		TRANSCODE_MAX_ATTEMPTS:  getEnvInt("TRANSCODE_MAX_ATTEMPTS", 5),
+		TRANSCODE_RETRY_BACKOFF: getEnvDuration("TRANSCODE_RETRY_BACKOFF", time.Minute),
+		ENCODING_LADDER_FILE:    os.Getenv("ENCODING_LADDER_FILE"),
+		THUMBNAIL_OFFSET:        getEnvDuration("THUMBNAIL_OFFSET", 3*time.Second),
+		SPRITE_INTERVAL:         getEnvDuration("SPRITE_INTERVAL", 5*time.Second),
+		OUTPUT_FORMATS:          getEnvList("OUTPUT_FORMATS", "hls"),
+		HLS_SEGMENT_TYPE:        getEnvDefault("HLS_SEGMENT_TYPE", "mpegts"),
+		HLS_ENCRYPTION:          getEnvDefault("HLS_ENCRYPTION", "none"),
+		HLS_KEY_ROTATION:        getEnvInt("HLS_KEY_ROTATION", 0),
+		UPLOAD_CONCURRENCY:      getEnvInt("UPLOAD_CONCURRENCY", 8),
+		UPLOAD_MAX_ATTEMPTS:     getEnvInt("UPLOAD_MAX_ATTEMPTS", 3),
+		PER_TITLE_ENCODING:      os.Getenv("PER_TITLE_ENCODING") == "true",
+		PER_TITLE_CRF:           getEnvInt("PER_TITLE_CRF", 23),
+		OPERATOR_USER_IDS:       splitList(os.Getenv("OPERATOR_USER_IDS")),
 	}, nil
 }
+
+// OutputEnabled reports whether the deployment publishes the output format.
+func (e *Env) OutputEnabled(format string) bool {
+	for _, enabled := range e.OUTPUT_FORMATS {
+		if enabled == format {
+			return true
+		}
+	}
+	return false
+}
+
+func getEnvDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration %q for %s, using %s", value, key, fallback)
+		return fallback
+	}
+	return duration
+}
+
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid number %q for %s, using %d", value, key, fallback)
+		return fallback
+	}
+	return number
+}
+
+func getEnvList(key, fallback string) []string {
+	list := splitList(getEnvDefault(key, fallback))
+	for i := range list {
+		list[i] = strings.ToLower(list[i])
+	}
+	return list
+}
+
+// splitList splits a comma separated value, keeping the case of its items.
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LadderRung describes one rendition of the encoding ladder.
+type LadderRung struct {
+	Name         string `json:"name"`
+	Height       int    `json:"height"`
+	VideoBitrate string `json:"video_bitrate"`
+	MaxRate      string `json:"maxrate"`
+	BufSize      string `json:"bufsize"`
+	AudioBitrate string `json:"audio_bitrate"`
+	Profile      string `json:"profile"`
+	// Codec is h264, h265 or av1, encoded with libx264, libx265 or libsvtav1
+	Codec string `json:"codec"`
+}
+
+// Profiles each codec can be encoded with, the first one is the default
+var codecProfiles = map[string][]string{
+	"h264": {"main", "baseline", "high"},
+	"h265": {"main", "main10"},
+	"av1":  {"main"},
+}
+
+var rungName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Names the pipeline uses for its own directories next to the renditions,
+// "original" is also the quality of the upload
+var reservedRungNames = []string{"original", "audio", "dash", "thumbs", "sprites", "subtitles"}
+
+// DefaultLadder is used when ENCODING_LADDER_FILE is not set.
+var DefaultLadder = []LadderRung{
+	{Name: "480p", Height: 480, VideoBitrate: "1000k", MaxRate: "1100k", BufSize: "2000k", AudioBitrate: "96k", Profile: "baseline", Codec: "h264"},
+	{Name: "720p", Height: 720, VideoBitrate: "2500k", MaxRate: "2750k", BufSize: "5000k", AudioBitrate: "128k", Profile: "baseline", Codec: "h264"},
+}
+
+// LoadLadder reads the ladder from a JSON file, an empty path returns DefaultLadder.
+func LoadLadder(path string) ([]LadderRung, error) {
+	if path == "" {
+		return DefaultLadder, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encoding ladder %s: %w", path, err)
+	}
+
+	var ladder []LadderRung
+	if err := json.Unmarshal(data, &ladder); err != nil {
+		return nil, fmt.Errorf("failed to parse encoding ladder %s: %w", path, err)
+	}
+
+	for i := range ladder {
+		if ladder[i].Codec == "" {
+			ladder[i].Codec = "h264"
+		}
+		if profiles := codecProfiles[ladder[i].Codec]; ladder[i].Profile == "" && len(profiles) > 0 {
+			ladder[i].Profile = profiles[0]
+		}
+	}
+
+	if err := validateLadder(ladder); err != nil {
+		return nil, fmt.Errorf("invalid encoding ladder %s: %w", path, err)
+	}
+	return ladder, nil
+}
+
+func validateLadder(ladder []LadderRung) error {
+	if len(ladder) == 0 {
+		return fmt.Errorf("ladder has no rungs")
+	}
+
+	names := map[string]bool{}
+	for i, rung := range ladder {
+		// Names are directories and -var_stream_map entries
+		if !rungName.MatchString(rung.Name) {
+			return fmt.Errorf("rung %d has an invalid name %q", i, rung.Name)
+		}
+		if slices.Contains(reservedRungNames, rung.Name) {
+			return fmt.Errorf("rung %d has the reserved name %q", i, rung.Name)
+		}
+		if names[rung.Name] {
+			return fmt.Errorf("rung name %q is used twice", rung.Name)
+		}
+		names[rung.Name] = true
+
+		profiles, ok := codecProfiles[rung.Codec]
+		if !ok {
+			return fmt.Errorf("rung %s has an unsupported codec %q, use h264, h265 or av1", rung.Name, rung.Codec)
+		}
+		if !slices.Contains(profiles, rung.Profile) {
+			return fmt.Errorf("rung %s has an unsupported %s profile %q", rung.Name, rung.Codec, rung.Profile)
+		}
+
+		if rung.Height <= 0 {
+			return fmt.Errorf("rung %s has an invalid height %d", rung.Name, rung.Height)
+		}
+		for _, bitrate := range []string{rung.VideoBitrate, rung.MaxRate, rung.BufSize, rung.AudioBitrate} {
+			if _, err := ParseBitrate(bitrate); err != nil {
+				return fmt.Errorf("rung %s: %w", rung.Name, err)
+			}
+		}
+	}
+
+	// Clients without HEVC or AV1 support fall back to the H.264 renditions
+	if !slices.ContainsFunc(ladder, func(rung LadderRung) bool { return rung.Codec == "h264" }) {
+		return fmt.Errorf("ladder needs at least one h264 rung")
+	}
+	return nil
+}
+
+// ParseBitrate converts an ffmpeg style bitrate like "2500k" or "5M" to bits per second.
+func ParseBitrate(bitrate string) (int, error) {
+	multiplier := 1
+	number := strings.TrimSpace(bitrate)
+	switch {
+	case strings.HasSuffix(number, "k"), strings.HasSuffix(number, "K"):
+		multiplier, number = 1000, number[:len(number)-1]
+	case strings.HasSuffix(number, "M"):
+		multiplier, number = 1000000, number[:len(number)-1]
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid bitrate %q", bitrate)
+	}
+	return int(value * float64(multiplier)), nil
+}
@@ -0,0 +1,21 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateLadderRejectsReservedNames(t *testing.T) {
+	for _, name := range []string{"original", "audio", "dash", "thumbs", "sprites", "subtitles"} {
+		rung := DefaultLadder[0]
+		rung.Name = name
+		err := validateLadder([]LadderRung{rung})
+		if err == nil || !strings.Contains(err.Error(), "reserved") {
+			t.Errorf("rung named %q: error = %v, want reserved name", name, err)
+		}
+	}
+
+	if err := validateLadder(DefaultLadder); err != nil {
+		t.Errorf("default ladder: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"video-feed/internal/services"
+	"video-feed/pkg/utils"
+	"video-feed/pkg/utils/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CancelProcessing stops the queued or running transcode of a video and
+// removes its partial output. The original stays, so it can be queued again.
+func (vc *VideoController) CancelProcessing(c *gin.Context) {
+	err := vc.service.CancelProcessing(c.Param("id"), utils.GetUserID(c))
+	switch {
+	case errors.Is(err, services.ErrVideoNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Video not found"})
+	case errors.Is(err, services.ErrNotProcessing):
+		c.JSON(http.StatusConflict, gin.H{"error": "Video is not processing"})
+	case err != nil:
+		logger.Log.Error("failed to cancel processing", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel processing"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"status": "Processing cancelled"})
+	}
+}
@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"video-feed/internal/services"
+	"video-feed/pkg/utils"
+	"video-feed/pkg/utils/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+type KeyController struct {
+	service *services.KeyService
+}
+
+func NewKeyController(service *services.KeyService) *KeyController {
+	return &KeyController{service: service}
+}
+
+// GetKey serves the raw 16 byte key an EXT-X-KEY URI points at
+func (kc *KeyController) GetKey(c *gin.Context) {
+	key, err := kc.service.GetKey(c.Param("videoID"), utils.GetUserID(c), utils.StringToInt(c.Query("key")))
+	if errors.Is(err, services.ErrKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Key not found"})
+		return
+	}
+	if err != nil {
+		logger.Log.Error("failed to get key", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get key"})
+		return
+	}
+
+	// Keys must not end up in shared caches
+	c.Header("Cache-Control", "private, no-store")
+	c.Data(http.StatusOK, "application/octet-stream", key)
+}
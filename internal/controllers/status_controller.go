@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"time"
+	"video-feed/internal/dto"
+	"video-feed/internal/services"
+	"video-feed/pkg/utils/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How often the status stream checks the job for changes
+const statusPollInterval = time.Second
+
+func (vc *VideoController) GetStatus(c *gin.Context) {
+	status, err := vc.service.VideoStatus(c.Param("id"))
+	if errors.Is(err, services.ErrVideoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Video not found"})
+		return
+	}
+	if err != nil {
+		logger.Log.Error("failed to get video status", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get video status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// StreamStatus sends a status event with Server-Sent Events whenever the
+// status changes, and closes the stream once the video is ready, failed or
+// cancelled.
+func (vc *VideoController) StreamStatus(c *gin.Context) {
+	videoID := c.Param("id")
+	if _, err := vc.service.VideoStatus(videoID); err != nil {
+		vc.GetStatus(c)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	var last *dto.VideoStatusResponse
+	ticker := time.NewTicker(statusPollInterval)
+	defer ticker.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		status, err := vc.service.VideoStatus(videoID)
+		if err != nil {
+			logger.Log.Error("failed to get video status", err)
+			c.SSEvent("error", gin.H{"error": "Failed to get video status"})
+			return false
+		}
+
+		if last == nil || !reflect.DeepEqual(last, status) {
+			c.SSEvent("status", status)
+			last = status
+		}
+		if status.Status == "ready" || status.Status == "failed" || status.Status == "cancelled" {
+			return false
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ticker.C:
+			return true
+		}
+	})
+}
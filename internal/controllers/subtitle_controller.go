@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"video-feed/internal/services"
+	"video-feed/pkg/utils"
+	"video-feed/pkg/utils/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadSubtitle takes a multipart form with a file (SRT or WebVTT),
+// a language tag and an optional label.
+func (vc *VideoController) UploadSubtitle(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing subtitle file"})
+		return
+	}
+
+	subtitle, err := vc.service.UploadSubtitle(c.Param("id"), utils.GetUserID(c), c.PostForm("language"), c.PostForm("label"), file)
+	if err != nil {
+		subtitleError(c, "failed to upload subtitle", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subtitle)
+}
+
+func (vc *VideoController) ListSubtitles(c *gin.Context) {
+	subtitles, err := vc.service.ListSubtitles(c.Param("id"))
+	if err != nil {
+		logger.Log.Error("failed to list subtitles", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list subtitles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"subtitles": subtitles})
+}
+
+func (vc *VideoController) DeleteSubtitle(c *gin.Context) {
+	err := vc.service.DeleteSubtitle(c.Param("id"), utils.GetUserID(c), c.Param("language"))
+	if err != nil {
+		subtitleError(c, "failed to delete subtitle", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "Subtitle deleted"})
+}
+
+func subtitleError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrVideoNotFound), errors.Is(err, services.ErrSubtitleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidSubtitle):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		logger.Log.Error(message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error", "err": err.Error()})
+	}
+}
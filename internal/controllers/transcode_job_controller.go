@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"net/http"
+	"video-feed/internal/models"
+	"video-feed/internal/services"
+	"video-feed/pkg/utils"
+	"video-feed/pkg/utils/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TranscodeJobController struct {
+	pool *services.TranscodeWorkerPool
+}
+
+func NewTranscodeJobController(pool *services.TranscodeWorkerPool) *TranscodeJobController {
+	return &TranscodeJobController{pool: pool}
+}
+
+// ListJobs lists jobs by state, defaulting to the dead-letter queue
+func (tc *TranscodeJobController) ListJobs(c *gin.Context) {
+	state := models.TranscodeJobState(c.DefaultQuery("state", string(models.JobDead)))
+	limit := utils.StringToInt(c.DefaultQuery("limit", "100"))
+	offset := utils.StringToInt(c.Query("offset"))
+
+	jobs, err := tc.pool.ListJobs(state, limit, offset)
+	if err != nil {
+		logger.Log.Error("failed to list transcode jobs", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list transcode jobs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+func (tc *TranscodeJobController) RetryJob(c *gin.Context) {
+	retried, err := tc.pool.RetryJob(c.Param("id"))
+	if err != nil {
+		logger.Log.Error("failed to retry transcode job", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry transcode job"})
+		return
+	}
+	if !retried {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No failed or dead job with this id"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "Job queued"})
+}
@@ -1,9 +1,12 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 	"video-feed/internal/dto"
 	"video-feed/internal/services"
+	"video-feed/pkg/storage"
 	"video-feed/pkg/utils"
 	"video-feed/pkg/utils/logger"
 
@@ -47,14 +50,14 @@ func (vc *VideoController) InitiateChunkUpload(c *gin.Context) {
 		return
 	}
 
-	uploadID, err := vc.service.InitiateChunkUpload(requestData)
+	response, err := vc.service.InitiateChunkUpload(requestData)
 	if err != nil {
 		logger.Log.Error("failed to initiate chunk upload", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "error", "err": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"uploadId": uploadID})
+	c.JSON(http.StatusOK, response)
 }
 
 func (vc *VideoController) UploadChunk(c *gin.Context) {
@@ -96,3 +99,20 @@ func (vc *VideoController) CompleteChunkUpload(c *gin.Context) {
 
 	c.JSON(http.StatusOK, video)
 }
+
+func (vc *VideoController) GetPlaylist(c *gin.Context) {
+	playlist, err := vc.service.SignedPlaylist(c.Param("id"), strings.TrimPrefix(c.Param("path"), "/"))
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		return
+	}
+	if err != nil {
+		logger.Log.Error("failed to sign playlist", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error", "err": err.Error()})
+		return
+	}
+
+	// Signed URLs inside expire, do not let players or proxies cache the playlist
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, storage.ContentTypeFor(c.Param("path")), playlist)
+}
@@ -1,10 +1,22 @@
 package dto
 
-import "mime/multipart"
+import (
+	"mime/multipart"
+	"video-feed/internal/models"
+)
 
 type InitiateChunkDTO struct {
 	FileName    string `json:"fileName"`
 	TotalChunks int    `json:"totalChunks"`
+	ContentType string `json:"contentType"`
+	// Direct asks for presigned part URLs so chunks go straight to the bucket
+	Direct bool `json:"direct"`
+}
+
+type InitiateChunkResponse struct {
+	UploadID string   `json:"uploadId"`
+	Mode     string   `json:"mode"`
+	PartURLs []string `json:"partUrls,omitempty"`
 }
 
 type ChunkUploadDTO struct {
@@ -17,3 +29,20 @@ type CompleteChunkUploadDTO struct {
 	UploadID    string `json:"uploadId" binding:"required"`
 	Description string `json:"description"`
 }
+
+// VideoStatusResponse summarizes processing of a video for polling clients
+// and the status event stream.
+type VideoStatusResponse struct {
+	VideoID string `json:"video_id"`
+	// Status is uploaded, queued, processing, ready, failed or cancelled
+	Status          string `json:"status"`
+	HLSProcessed    bool   `json:"hls_processed"`
+	ProcessingError string `json:"processing_error"`
+	// Playable is set as soon as the first rendition is published
+	Playable   bool    `json:"playable"`
+	Percent    float64 `json:"percent"`
+	ETASeconds float64 `json:"eta_seconds"`
+	// Renditions holds the progress of the current attempt
+	Renditions map[string]models.RenditionProgress `json:"renditions"`
+	Attempts   int                                 `json:"attempts"`
+}
@@ -8,4 +8,9 @@ type ChunkInfo struct {
 	TotalChunks int       `json:"totalChunks"`
 	FileName    string    `json:"fileName"`
 	CreatedAt   time.Time `json:"createdAt"`
+	// Set for direct uploads, where parts are stored as a multipart upload in the bucket
+	Direct          bool   `json:"direct,omitempty"`
+	VideoID         string `json:"videoId,omitempty"`
+	ObjectName      string `json:"objectName,omitempty"`
+	StorageUploadID string `json:"storageUploadId,omitempty"`
 }
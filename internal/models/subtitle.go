@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Subtitle is a WebVTT caption track of a video, one per language.
+type Subtitle struct {
+	ID       string `json:"id"`
+	VideoID  string `json:"video_id"`
+	Language string `json:"language"`
+	Label    string `json:"label"`
+	// VTTURL holds the object key, it is resolved to a URL when served
+	VTTURL    string    `json:"vtt_url"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+	"video-feed/config"
+)
+
+type TranscodeJobState string
+
+const (
+	JobQueued    TranscodeJobState = "queued"
+	JobRunning   TranscodeJobState = "running"
+	JobSucceeded TranscodeJobState = "succeeded"
+	// JobFailed jobs hit a permanent error, retrying would fail the same way
+	JobFailed TranscodeJobState = "failed"
+	// JobDead jobs ran out of attempts and wait for an operator
+	JobDead TranscodeJobState = "dead"
+	// JobCancelled jobs were stopped by the owner of the video
+	JobCancelled TranscodeJobState = "cancelled"
+)
+
+type JobErrorKind string
+
+const (
+	JobErrorTransient JobErrorKind = "transient"
+	JobErrorPermanent JobErrorKind = "permanent"
+)
+
+type JobAttemptError struct {
+	Attempt  int          `json:"attempt"`
+	Kind     JobErrorKind `json:"kind"`
+	Error    string       `json:"error"`
+	WorkerID string       `json:"worker_id"`
+	FailedAt time.Time    `json:"failed_at"`
+}
+
+// RenditionProgress is how far ffmpeg got with one rendition of a running job.
+type RenditionProgress struct {
+	Percent    float64   `json:"percent"`
+	ETASeconds float64   `json:"eta_seconds"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// LadderChoice records the encoding ladder an attempt picked and why.
+type LadderChoice struct {
+	// PerTitle is false when the configured ladder was used as is
+	PerTitle bool `json:"per_title"`
+	// SampleBitrate is what the CRF probe encode of the samples needed, in
+	// bits per second at SampleHeight
+	SampleBitrate int `json:"sample_bitrate,omitempty"`
+	SampleHeight  int `json:"sample_height,omitempty"`
+	// Scale multiplied the bitrates of the configured ladder
+	Scale float64             `json:"scale"`
+	Rungs []config.LadderRung `json:"rungs"`
+}
+
+type TranscodeJob struct {
+	ID           string            `json:"id"`
+	VideoID      string            `json:"video_id"`
+	InputPath    string            `json:"input_path"`
+	State        TranscodeJobState `json:"state"`
+	Attempts     int               `json:"attempts"`
+	MaxAttempts  int               `json:"max_attempts"`
+	NextRunAt    time.Time         `json:"next_run_at"`
+	Error        string            `json:"error"`
+	ErrorHistory []JobAttemptError `json:"error_history"`
+	// Progress of the current attempt by rendition name
+	Progress map[string]RenditionProgress `json:"progress"`
+	// Ladder of the current attempt, nil until it was chosen
+	Ladder      *LadderChoice `json:"ladder"`
+	WorkerID    string        `json:"worker_id"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	StartedAt   *time.Time    `json:"started_at"`
+	HeartbeatAt *time.Time    `json:"heartbeat_at"`
+	FinishedAt  *time.Time    `json:"finished_at"`
+}
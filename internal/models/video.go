@@ -7,11 +7,57 @@ type Video struct {
 	UserID          string    `json:"user_id"`
 	OriginalURL     string    `json:"original_url"`
 	HLSURL          string    `json:"hls_url"`
+	DASHURL         string    `json:"dash_url"`
 	ThumbnailURL    string    `json:"thumbnail_url"`
-	Duration        float64   `json:"duration"`
+	SpriteVTTURL    string    `json:"sprite_vtt_url"`
 	Description     string    `json:"description"`
 	CreatedAt       time.Time `json:"created_at"`
 	Qualities       []string  `json:"qualities"`
 	HLSProcessed    bool      `json:"hls_processed"`
 	ProcessingError string    `json:"processing_error"`
+	// Playable is set once the first rendition is published, before
+	// processing finishes
+	Playable bool `json:"playable"`
+	// Renditions is the state of every rung of the current processing attempt
+	Renditions map[string]RenditionState `json:"renditions"`
+	// CancelledAt is set when processing was cancelled by the owner
+	CancelledAt *time.Time `json:"cancelled_at"`
+	MediaInfo
+}
+
+type RenditionState string
+
+const (
+	RenditionPending  RenditionState = "pending"
+	RenditionEncoding RenditionState = "encoding"
+	RenditionReady    RenditionState = "ready"
+)
+
+// MediaInfo is what ffprobe reports about the uploaded original.
+type MediaInfo struct {
+	Duration   float64 `json:"duration"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	FrameRate  float64 `json:"frame_rate"`
+	VideoCodec string  `json:"video_codec"`
+	AudioCodec string  `json:"audio_codec"`
+	Rotation   int     `json:"rotation"`
+	Bitrate    int64   `json:"bitrate"`
+	Format     string  `json:"container_format"`
+}
+
+// DisplayHeight is the height after rotation, which is what players show.
+func (m MediaInfo) DisplayHeight() int {
+	if m.Rotation%180 != 0 {
+		return m.Width
+	}
+	return m.Height
+}
+
+// DisplayWidth is the width after rotation.
+func (m MediaInfo) DisplayWidth() int {
+	if m.Rotation%180 != 0 {
+		return m.Height
+	}
+	return m.Width
 }
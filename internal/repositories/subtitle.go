@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"video-feed/internal/models"
+	"video-feed/pkg/database"
+)
+
+type SubtitleRepository struct {
+	dbManager *database.DatabaseManager
+}
+
+func NewSubtitleRepository(dbManager *database.DatabaseManager) *SubtitleRepository {
+	return &SubtitleRepository{
+		dbManager: dbManager,
+	}
+}
+
+// Upsert saves the track, replacing the one of the same language
+func (r *SubtitleRepository) Upsert(subtitle *models.Subtitle) error {
+	query := `
+		INSERT INTO subtitles (id, video_id, language, label, vtt_url, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (video_id, language) DO UPDATE
+		SET label = EXCLUDED.label,
+			vtt_url = EXCLUDED.vtt_url,
+			created_at = EXCLUDED.created_at
+		RETURNING id
+	`
+	return r.dbManager.QueryRow(query,
+		subtitle.ID, subtitle.VideoID, subtitle.Language, subtitle.Label, subtitle.VTTURL, subtitle.CreatedAt,
+	).Scan(&subtitle.ID)
+}
+
+// ListByVideo returns the tracks of a video ordered by language
+func (r *SubtitleRepository) ListByVideo(videoID string) ([]models.Subtitle, error) {
+	query := `
+		SELECT id, video_id, language, label, vtt_url, created_at
+		FROM subtitles
+		WHERE video_id = $1
+		ORDER BY language
+	`
+
+	rows, err := r.dbManager.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subtitles := []models.Subtitle{}
+	for rows.Next() {
+		var subtitle models.Subtitle
+		err := rows.Scan(&subtitle.ID, &subtitle.VideoID, &subtitle.Language, &subtitle.Label, &subtitle.VTTURL, &subtitle.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		subtitles = append(subtitles, subtitle)
+	}
+	return subtitles, rows.Err()
+}
+
+// Delete removes the track of a language, it reports whether one existed
+func (r *SubtitleRepository) Delete(videoID, language string) (bool, error) {
+	query := `DELETE FROM subtitles WHERE video_id = $1 AND language = $2`
+	result, err := r.dbManager.Exec(query, videoID, language)
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
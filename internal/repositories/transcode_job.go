@@ -0,0 +1,319 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+	"video-feed/internal/models"
+	"video-feed/pkg/database"
+)
+
+const transcodeJobColumns = `
+	id, video_id, input_path, state, attempts, max_attempts, next_run_at,
+	COALESCE(error, ''), error_history, progress, ladder, COALESCE(worker_id, ''),
+	created_at, updated_at, started_at, heartbeat_at, finished_at
+`
+
+type TranscodeJobRepository struct {
+	dbManager *database.DatabaseManager
+}
+
+func NewTranscodeJobRepository(dbManager *database.DatabaseManager) *TranscodeJobRepository {
+	return &TranscodeJobRepository{
+		dbManager: dbManager,
+	}
+}
+
+// Create enqueues a new job
+func (r *TranscodeJobRepository) Create(job *models.TranscodeJob) error {
+	query := `
+		INSERT INTO transcode_jobs (id, video_id, input_path, state, max_attempts, next_run_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6, $6)
+	`
+
+	job.State = models.JobQueued
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = job.CreatedAt
+	job.NextRunAt = job.CreatedAt
+	_, err := r.dbManager.Exec(query, job.ID, job.VideoID, job.InputPath, job.State, job.MaxAttempts, job.CreatedAt)
+	return err
+}
+
+// ClaimNext marks the oldest due queued job as running for workerID and returns it.
+// SKIP LOCKED lets concurrent workers claim different jobs without waiting on
+// each other. It returns nil when no job is due.
+func (r *TranscodeJobRepository) ClaimNext(workerID string) (*models.TranscodeJob, error) {
+	query := `
+		UPDATE transcode_jobs
+		SET state = $1,
+			worker_id = $2,
+			attempts = attempts + 1,
+			progress = '{}'::JSONB,
+			ladder = NULL,
+			started_at = NOW(),
+			heartbeat_at = NOW(),
+			updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM transcode_jobs
+			WHERE state = $3 AND next_run_at <= NOW()
+			ORDER BY next_run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + transcodeJobColumns
+
+	job, err := scanTranscodeJob(r.dbManager.QueryRow(query, models.JobRunning, workerID, models.JobQueued))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// Heartbeat records that the worker owning the job is still alive. It reports
+// false once the job is no longer running for the worker, e.g. because it was
+// cancelled or requeued after a missed heartbeat.
+func (r *TranscodeJobRepository) Heartbeat(jobID, workerID string) (bool, error) {
+	query := `UPDATE transcode_jobs SET heartbeat_at = NOW() WHERE id = $1 AND worker_id = $2 AND state = $3`
+	result, err := r.dbManager.Exec(query, jobID, workerID, models.JobRunning)
+	if err != nil {
+		return true, err
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// Cancel moves the queued or running job of a video to the cancelled state
+// and returns the state it was in, or "" when nothing was processing.
+func (r *TranscodeJobRepository) Cancel(videoID string) (models.TranscodeJobState, error) {
+	query := `
+		UPDATE transcode_jobs AS job
+		SET state = $1,
+			worker_id = NULL,
+			finished_at = NOW(),
+			updated_at = NOW()
+		FROM (
+			SELECT id, state FROM transcode_jobs
+			WHERE video_id = $2 AND state IN ($3, $4)
+			FOR UPDATE
+		) AS previous
+		WHERE job.id = previous.id
+		RETURNING previous.state
+	`
+
+	var previous models.TranscodeJobState
+	err := r.dbManager.QueryRow(query, models.JobCancelled, videoID, models.JobQueued, models.JobRunning).Scan(&previous)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return previous, err
+}
+
+// IsCancelled reports whether the job was cancelled while it ran
+func (r *TranscodeJobRepository) IsCancelled(jobID string) (bool, error) {
+	var state models.TranscodeJobState
+	err := r.dbManager.QueryRow(`SELECT state FROM transcode_jobs WHERE id = $1`, jobID).Scan(&state)
+	return state == models.JobCancelled, err
+}
+
+// Succeed marks a job as done. It reports false when workerID no longer
+// holds the job, e.g. because it was requeued after a missed heartbeat.
+func (r *TranscodeJobRepository) Succeed(jobID, workerID string) (bool, error) {
+	query := `
+		UPDATE transcode_jobs
+		SET state = $1,
+			error = '',
+			finished_at = NOW(),
+			updated_at = NOW()
+		WHERE id = $2 AND worker_id = $3 AND state = $4
+	`
+	result, err := r.dbManager.Exec(query, models.JobSucceeded, jobID, workerID, models.JobRunning)
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// Fail appends the attempt error to the job history and moves the job to
+// state. A queued state schedules a retry at nextRunAt. Like Succeed it
+// reports false when the worker of the attempt no longer holds the job.
+func (r *TranscodeJobRepository) Fail(jobID string, state models.TranscodeJobState, attempt models.JobAttemptError, nextRunAt time.Time) (bool, error) {
+	query := `
+		UPDATE transcode_jobs
+		SET state = $1,
+			error = $2,
+			error_history = error_history || $3::JSONB,
+			next_run_at = $4,
+			worker_id = NULL,
+			finished_at = $6,
+			updated_at = NOW()
+		WHERE id = $5 AND worker_id = $7 AND state = $8
+	`
+
+	historyJSON, err := json.Marshal([]models.JobAttemptError{attempt})
+	if err != nil {
+		return false, err
+	}
+
+	// A job waiting for a retry is not finished
+	var finishedAt *time.Time
+	if state != models.JobQueued {
+		finishedAt = &attempt.FailedAt
+	}
+
+	result, err := r.dbManager.Exec(query, state, attempt.Error, historyJSON, nextRunAt, jobID, finishedAt, attempt.WorkerID, models.JobRunning)
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// RequeueStale puts running jobs whose worker stopped sending heartbeats back
+// in the queue, which recovers jobs orphaned by a crash or restart. Jobs that
+// already used every attempt go to the dead-letter state instead, they are
+// returned so their videos can record the failure.
+func (r *TranscodeJobRepository) RequeueStale(timeout time.Duration) ([]models.TranscodeJob, error) {
+	query := `
+		UPDATE transcode_jobs
+		SET state = CASE WHEN attempts >= max_attempts THEN $1 ELSE $2 END,
+			error = CASE WHEN attempts >= max_attempts THEN 'worker stopped responding' ELSE error END,
+			worker_id = NULL,
+			next_run_at = NOW(),
+			updated_at = NOW()
+		WHERE state = $3 AND heartbeat_at < $4
+		RETURNING ` + transcodeJobColumns
+
+	rows, err := r.dbManager.Query(query, models.JobDead, models.JobQueued, models.JobRunning, time.Now().Add(-timeout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []models.TranscodeJob{}
+	for rows.Next() {
+		job, err := scanTranscodeJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// ListByState returns the most recently updated jobs in a state
+func (r *TranscodeJobRepository) ListByState(state models.TranscodeJobState, limit, offset int) ([]models.TranscodeJob, error) {
+	query := `SELECT ` + transcodeJobColumns + `
+		FROM transcode_jobs
+		WHERE state = $1
+		ORDER BY updated_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.dbManager.Query(query, state, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []models.TranscodeJob{}
+	for rows.Next() {
+		job, err := scanTranscodeJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// Retry queues a failed or dead job again with a fresh set of attempts,
+// the error history is kept.
+func (r *TranscodeJobRepository) Retry(jobID string) (bool, error) {
+	query := `
+		UPDATE transcode_jobs
+		SET state = $1,
+			attempts = 0,
+			next_run_at = NOW(),
+			finished_at = NULL,
+			updated_at = NOW()
+		WHERE id = $2 AND state IN ($3, $4)
+	`
+	result, err := r.dbManager.Exec(query, models.JobQueued, jobID, models.JobFailed, models.JobDead)
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// UpdateProgress stores the rendition progress of the running job of a video
+func (r *TranscodeJobRepository) UpdateProgress(videoID string, progress map[string]models.RenditionProgress) error {
+	query := `UPDATE transcode_jobs SET progress = $1 WHERE video_id = $2 AND state = $3`
+
+	progressJSON, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	_, err = r.dbManager.Exec(query, progressJSON, videoID, models.JobRunning)
+	return err
+}
+
+// UpdateLadder records the encoding ladder picked by the running job of a video
+func (r *TranscodeJobRepository) UpdateLadder(videoID string, ladder models.LadderChoice) error {
+	query := `UPDATE transcode_jobs SET ladder = $1 WHERE video_id = $2 AND state = $3`
+
+	ladderJSON, err := json.Marshal(ladder)
+	if err != nil {
+		return err
+	}
+	_, err = r.dbManager.Exec(query, ladderJSON, videoID, models.JobRunning)
+	return err
+}
+
+// LatestByVideo returns the most recent job of a video, or nil when it has none
+func (r *TranscodeJobRepository) LatestByVideo(videoID string) (*models.TranscodeJob, error) {
+	query := `SELECT ` + transcodeJobColumns + `
+		FROM transcode_jobs
+		WHERE video_id = $1
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	job, err := scanTranscodeJob(r.dbManager.QueryRow(query, videoID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTranscodeJob(row rowScanner) (*models.TranscodeJob, error) {
+	var job models.TranscodeJob
+	var historyJSON, progressJSON, ladderJSON []byte
+	err := row.Scan(
+		&job.ID, &job.VideoID, &job.InputPath, &job.State, &job.Attempts, &job.MaxAttempts, &job.NextRunAt,
+		&job.Error, &historyJSON, &progressJSON, &ladderJSON, &job.WorkerID,
+		&job.CreatedAt, &job.UpdatedAt, &job.StartedAt, &job.HeartbeatAt, &job.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(historyJSON, &job.ErrorHistory); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(progressJSON, &job.Progress); err != nil {
+		return nil, err
+	}
+	if ladderJSON != nil {
+		if err := json.Unmarshal(ladderJSON, &job.Ladder); err != nil {
+			return nil, err
+		}
+	}
+	return &job, nil
+}
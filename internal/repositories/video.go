@@ -22,8 +22,10 @@ func (r *VideoRepository) Create(video *models.Video) error {
 		id, user_id, original_url, hls_url, 
 		thumbnail_url, duration, description, 
 		created_at, qualities, hls_processed, 
-		processing_error
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		processing_error, width, height, frame_rate,
+		video_codec, audio_codec, rotation, bitrate,
+		container_format, sprite_vtt_url, dash_url
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
 	ON CONFLICT (id) DO UPDATE SET
 	original_url = EXCLUDED.original_url,
 	hls_url = EXCLUDED.hls_url,
@@ -32,7 +34,17 @@ func (r *VideoRepository) Create(video *models.Video) error {
 	description = EXCLUDED.description,
 	qualities = EXCLUDED.qualities,
 	hls_processed = EXCLUDED.hls_processed,
-	processing_error = EXCLUDED.processing_error
+	processing_error = EXCLUDED.processing_error,
+	width = EXCLUDED.width,
+	height = EXCLUDED.height,
+	frame_rate = EXCLUDED.frame_rate,
+	video_codec = EXCLUDED.video_codec,
+	audio_codec = EXCLUDED.audio_codec,
+	rotation = EXCLUDED.rotation,
+	bitrate = EXCLUDED.bitrate,
+	container_format = EXCLUDED.container_format,
+	sprite_vtt_url = EXCLUDED.sprite_vtt_url,
+	dash_url = EXCLUDED.dash_url
 `
 
 	qualitiesJSON, err := json.Marshal(video.Qualities)
@@ -45,7 +57,10 @@ func (r *VideoRepository) Create(video *models.Video) error {
 		video.ID, video.UserID, video.OriginalURL, video.HLSURL,
 		video.ThumbnailURL, video.Duration, video.Description,
 		video.CreatedAt, qualitiesJSON, // SIMPAN JSON KE KOLOM JSONB
-		video.HLSProcessed, video.ProcessingError,
+		video.HLSProcessed, video.ProcessingError, video.Width,
+		video.Height, video.FrameRate, video.VideoCodec, video.AudioCodec,
+		video.Rotation, video.Bitrate, video.Format, video.SpriteVTTURL,
+		video.DASHURL,
 	)
 	return err
 }
@@ -58,18 +73,24 @@ func (r *VideoRepository) GetVideoByID(videoID string) (*models.Video, error) {
 			id, user_id, original_url, hls_url, 
 			thumbnail_url, duration, description, 
 			created_at, qualities, hls_processed, 
-			processing_error
+			processing_error, width, height, frame_rate,
+			video_codec, audio_codec, rotation, bitrate,
+			container_format, sprite_vtt_url, dash_url,
+			cancelled_at, playable, renditions
 		FROM videos 
 		WHERE id = $1
 	`
 
-	var qualitiesJSON []byte
+	var qualitiesJSON, renditionsJSON []byte
 	// Gunakan dbManager untuk query
 	err := r.dbManager.QueryRow(query, videoID).Scan(
 		&video.ID, &video.UserID, &video.OriginalURL, &video.HLSURL,
 		&video.ThumbnailURL, &video.Duration, &video.Description,
 		&video.CreatedAt, &qualitiesJSON, &video.HLSProcessed,
-		&video.ProcessingError,
+		&video.ProcessingError, &video.Width, &video.Height, &video.FrameRate,
+		&video.VideoCodec, &video.AudioCodec, &video.Rotation, &video.Bitrate,
+		&video.Format, &video.SpriteVTTURL, &video.DASHURL,
+		&video.CancelledAt, &video.Playable, &renditionsJSON,
 	)
 
 	if err != nil {
@@ -81,18 +102,31 @@ func (r *VideoRepository) GetVideoByID(videoID string) (*models.Video, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := json.Unmarshal(renditionsJSON, &video.Renditions); err != nil {
+		return nil, err
+	}
 
 	return &video, nil
 }
 
-// UpdateVideoProcessingStatus updates the processing status of a video
-func (r *VideoRepository) UpdateVideoProcessingStatus(videoID string, processed bool, processingError string, qualities []string, hls_url string) error {
+// UpdateVideoProcessingStatus updates the processing status of a video. A
+// failed video only records the error, renditions published before the
+// failure stay playable.
+func (r *VideoRepository) UpdateVideoProcessingStatus(videoID string, processed bool, processingError string, qualities []string, hls_url string, dash_url string) error {
+	if !processed {
+		query := `UPDATE videos SET hls_processed = FALSE, processing_error = $1 WHERE id = $2`
+		_, err := r.dbManager.Exec(query, processingError, videoID)
+		return err
+	}
+
 	query := `
 		UPDATE videos 
-		SET hls_processed = $1, 
-		    processing_error = $2,
-			qualities = $3,
-			hls_url = $4
+		SET hls_processed = TRUE, 
+			playable = TRUE,
+		    processing_error = $1,
+			qualities = $2,
+			hls_url = $3,
+			dash_url = $4
 		WHERE id = $5
 	`
 
@@ -102,7 +136,102 @@ func (r *VideoRepository) UpdateVideoProcessingStatus(videoID string, processed
 	}
 
 	// Gunakan dbManager untuk eksekusi query
-	_, err = r.dbManager.Exec(query, processed, processingError, qualitiesJSON, hls_url, videoID)
+	_, err = r.dbManager.Exec(query, processingError, qualitiesJSON, hls_url, dash_url, videoID)
+	return err
+}
+
+// UpdateMediaInfo stores the probed metadata of the original upload
+func (r *VideoRepository) UpdateMediaInfo(videoID string, info models.MediaInfo) error {
+	query := `
+		UPDATE videos 
+		SET duration = $1,
+			width = $2,
+			height = $3,
+			frame_rate = $4,
+			video_codec = $5,
+			audio_codec = $6,
+			rotation = $7,
+			bitrate = $8,
+			container_format = $9
+		WHERE id = $10
+	`
+
+	_, err := r.dbManager.Exec(query,
+		info.Duration, info.Width, info.Height, info.FrameRate,
+		info.VideoCodec, info.AudioCodec, info.Rotation, info.Bitrate,
+		info.Format, videoID,
+	)
+	return err
+}
+
+// UpdateThumbnailURL stores the object key of the poster image
+func (r *VideoRepository) UpdateThumbnailURL(videoID, thumbnailURL string) error {
+	query := `UPDATE videos SET thumbnail_url = $1 WHERE id = $2`
+	_, err := r.dbManager.Exec(query, thumbnailURL, videoID)
+	return err
+}
+
+// UpdateSpriteVTTURL stores the object key of the trick-play WebVTT track
+func (r *VideoRepository) UpdateSpriteVTTURL(videoID, spriteVTTURL string) error {
+	query := `UPDATE videos SET sprite_vtt_url = $1 WHERE id = $2`
+	_, err := r.dbManager.Exec(query, spriteVTTURL, videoID)
+	return err
+}
+
+// UpdateRenditions stores the state of every rendition of the video
+func (r *VideoRepository) UpdateRenditions(videoID string, renditions map[string]models.RenditionState) error {
+	renditionsJSON, err := json.Marshal(renditions)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.dbManager.Exec(`UPDATE videos SET renditions = $1 WHERE id = $2`, renditionsJSON, videoID)
+	return err
+}
+
+// PublishRenditions makes the video playable with the renditions published
+// so far, the video keeps processing until UpdateVideoProcessingStatus
+func (r *VideoRepository) PublishRenditions(videoID string, renditions map[string]models.RenditionState, qualities []string, hlsURL string) error {
+	query := `
+		UPDATE videos
+		SET playable = TRUE,
+			renditions = $1,
+			qualities = $2,
+			hls_url = $3
+		WHERE id = $4
+	`
+
+	renditionsJSON, err := json.Marshal(renditions)
+	if err != nil {
+		return err
+	}
+	qualitiesJSON, err := json.Marshal(qualities)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.dbManager.Exec(query, renditionsJSON, qualitiesJSON, hlsURL, videoID)
+	return err
+}
+
+// MarkCancelled records that processing was cancelled and forgets the
+// output that was removed from storage
+func (r *VideoRepository) MarkCancelled(videoID string) error {
+	query := `
+		UPDATE videos
+		SET hls_processed = FALSE,
+			processing_error = '',
+			qualities = '["original"]'::JSONB,
+			hls_url = '',
+			dash_url = '',
+			thumbnail_url = '',
+			sprite_vtt_url = '',
+			playable = FALSE,
+			renditions = '{}'::JSONB,
+			cancelled_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.dbManager.Exec(query, videoID)
 	return err
 }
 
@@ -113,7 +242,10 @@ func (r *VideoRepository) ListUserVideos(userID string, limit, offset int) ([]mo
 			id, user_id, original_url, hls_url, 
 			thumbnail_url, duration, description, 
 			created_at, qualities, hls_processed, 
-			processing_error
+			processing_error, width, height, frame_rate,
+			video_codec, audio_codec, rotation, bitrate,
+			container_format, sprite_vtt_url, dash_url,
+			cancelled_at, playable, renditions
 		FROM videos 
 		WHERE user_id = $1 
 		ORDER BY created_at DESC 
@@ -131,12 +263,15 @@ func (r *VideoRepository) ListUserVideos(userID string, limit, offset int) ([]mo
 	for rows.Next() {
 		var video models.Video
 
-		var qualitiesJSON []byte // JSONB akan di-scan sebagai []byte
+		var qualitiesJSON, renditionsJSON []byte // JSONB akan di-scan sebagai []byte
 		err = rows.Scan(
 			&video.ID, &video.UserID, &video.OriginalURL, &video.HLSURL,
 			&video.ThumbnailURL, &video.Duration, &video.Description,
 			&video.CreatedAt, &qualitiesJSON, &video.HLSProcessed,
-			&video.ProcessingError,
+			&video.ProcessingError, &video.Width, &video.Height, &video.FrameRate,
+			&video.VideoCodec, &video.AudioCodec, &video.Rotation, &video.Bitrate,
+			&video.Format, &video.SpriteVTTURL, &video.DASHURL,
+			&video.CancelledAt, &video.Playable, &renditionsJSON,
 		)
 		if err != nil {
 			return nil, err
@@ -147,6 +282,9 @@ func (r *VideoRepository) ListUserVideos(userID string, limit, offset int) ([]mo
 		if err != nil {
 			return nil, err
 		}
+		if err := json.Unmarshal(renditionsJSON, &video.Renditions); err != nil {
+			return nil, err
+		}
 
 		videos = append(videos, video)
 	}
@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"video-feed/pkg/database"
+)
+
+type VideoKeyRepository struct {
+	dbManager *database.DatabaseManager
+}
+
+func NewVideoKeyRepository(dbManager *database.DatabaseManager) *VideoKeyRepository {
+	return &VideoKeyRepository{
+		dbManager: dbManager,
+	}
+}
+
+// List returns the keys of the video ordered by their index
+func (r *VideoKeyRepository) List(videoID string) ([][]byte, error) {
+	rows, err := r.dbManager.Query(`SELECT key_data FROM video_keys WHERE video_id = $1 ORDER BY key_index`, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys [][]byte
+	for rows.Next() {
+		var key []byte
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Append stores keys after the ones the video already has, existing keys
+// are never changed since published segments are encrypted with them
+func (r *VideoKeyRepository) Append(videoID string, keys [][]byte) error {
+	tx, err := r.dbManager.BeginTransaction()
+	if err != nil {
+		return err
+	}
+
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM video_keys WHERE video_id = $1`, videoID).Scan(&count); err != nil {
+		r.dbManager.RollbackTransaction(tx)
+		return err
+	}
+	for i, key := range keys {
+		_, err := tx.Exec(`INSERT INTO video_keys (video_id, key_index, key_data) VALUES ($1, $2, $3)`, videoID, count+i, key)
+		if err != nil {
+			r.dbManager.RollbackTransaction(tx)
+			return err
+		}
+	}
+	return r.dbManager.CommitTransaction(tx)
+}
+
+// Get returns a key of the video, or nil when there is none
+func (r *VideoKeyRepository) Get(videoID string, index int) ([]byte, error) {
+	var key []byte
+	err := r.dbManager.QueryRow(`SELECT key_data FROM video_keys WHERE video_id = $1 AND key_index = $2`, videoID, index).Scan(&key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return key, err
+}
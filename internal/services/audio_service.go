@@ -0,0 +1,23 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+)
+
+// processAudio encodes the first audio stream once into its own HLS
+// rendition, which every video variant references as an audio group.
+func (h *HLSBackgroundJob) processAudio(ctx context.Context, inputPath, outputDir, bitrate string, progress func(encoded float64)) error {
+	return h.Transcoder.EncodeRendition(ctx, inputPath, RenditionSpec{
+		OutputDir:       outputDir,
+		AudioBitrate:    bitrate,
+		SegmentType:     h.Cfg.Env.HLS_SEGMENT_TYPE,
+		SegmentDuration: hlsSegmentDuration,
+		Progress:        progress,
+	})
+}
+
+// audioDir is the rendition directory of the audio group.
+func audioDir(outputDir string) string {
+	return filepath.Join(outputDir, "audio")
+}
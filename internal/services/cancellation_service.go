@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"video-feed/internal/models"
+	"video-feed/pkg/storage"
+	"video-feed/pkg/utils/logger"
+)
+
+var ErrNotProcessing = errors.New("video is not processing")
+
+// cancellationRegistry holds the cancel functions of the pipelines running in
+// this process, keyed by video ID.
+type cancellationRegistry struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+// start returns the context a pipeline runs with. Cancelling it kills the
+// ffmpeg processes started with it.
+func (r *cancellationRegistry) start(videoID string, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	r.mu.Lock()
+	if r.cancels == nil {
+		r.cancels = map[string]context.CancelFunc{}
+	}
+	r.cancels[videoID] = cancel
+	r.mu.Unlock()
+
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.cancels, videoID)
+		r.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancel stops the pipeline of the video and reports whether one was running here.
+func (r *cancellationRegistry) cancel(videoID string) bool {
+	r.mu.Lock()
+	cancel, ok := r.cancels[videoID]
+	r.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// Cancel stops the pipeline of a video if it runs in this process.
+func (h *HLSBackgroundJob) Cancel(videoID string) bool {
+	return h.running.cancel(videoID)
+}
+
+// CleanupCancelled removes what a cancelled pipeline produced, locally and in
+// storage, and marks the video cancelled. The original upload and subtitle
+// tracks stay so the video can be processed again.
+func (h *HLSBackgroundJob) CleanupCancelled(videoID string) error {
+	if err := h.removeOutput(videoID); err != nil {
+		return err
+	}
+	return h.Repo.MarkCancelled(videoID)
+}
+
+// removeOutput deletes the transcoded output of a video, locally and in
+// storage, except the original upload and subtitle tracks.
+func (h *HLSBackgroundJob) removeOutput(videoID string) error {
+	video, err := h.Repo.GetVideoByID(videoID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(fmt.Sprintf("tmp/videos/%s", videoID)); err != nil {
+		logger.Log.Error("failed to remove output of video ", videoID, ": ", err)
+	}
+
+	prefix := videoPrefix(videoID)
+	objects, err := h.Storage.ListObjects(prefix)
+	if err != nil {
+		return transientError("failed to list output of video %s: %v", videoID, err)
+	}
+	for _, object := range objects {
+		if object.Key == video.OriginalURL || strings.HasPrefix(object.Key, prefix+"subtitles/") {
+			continue
+		}
+		if err := h.Storage.DeleteObject(object.Key); err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			return transientError("failed to delete %s: %v", object.Key, err)
+		}
+	}
+	return nil
+}
+
+// CancelVideo cancels the queued or running job of a video. A running job
+// stops right away when its pipeline runs in this process, other workers
+// notice on their next heartbeat and clean up after themselves.
+func (p *TranscodeWorkerPool) CancelVideo(videoID string) error {
+	previous, err := p.Jobs.Cancel(videoID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel transcode job: %v", err)
+	}
+
+	switch previous {
+	case models.JobRunning:
+		p.HLSJob.Cancel(videoID)
+		return nil
+	case models.JobQueued:
+		// No worker owns the job, earlier attempts may have left output behind
+		return p.HLSJob.CleanupCancelled(videoID)
+	}
+	return ErrNotProcessing
+}
+
+// CancelProcessing stops the transcode of a video owned by userID.
+func (vs *VideoService) CancelProcessing(videoID, userID string) error {
+	if _, err := vs.ownedVideo(videoID, userID); err != nil {
+		return err
+	}
+	return vs.queue.CancelVideo(videoID)
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"video-feed/pkg/dash"
+)
+
+// packageDASH remuxes the encoded HLS renditions into an MPEG-DASH
+// presentation under outputDir/dash without encoding them again. Segments are
+// listed explicitly (SegmentList) so the manifest can be signed per segment.
+func (h *HLSBackgroundJob) packageDASH(ctx context.Context, outputDir string, renditions []renditionInfo, audio *renditionInfo) error {
+	dashDir := filepath.Join(outputDir, "dash")
+	if err := os.MkdirAll(dashDir, os.ModePerm); err != nil {
+		return transientError("failed to create DASH directory: %v", err)
+	}
+
+	if h.Cfg.Env.HLS_SEGMENT_TYPE == "fmp4" {
+		return writeSharedManifest(dashDir, renditions, audio)
+	}
+
+	spec := DASHSpec{
+		SegmentDuration: hlsSegmentDuration,
+		ManifestPath:    filepath.Join(dashDir, "manifest.mpd"),
+	}
+	for _, rendition := range renditions {
+		spec.VideoPlaylists = append(spec.VideoPlaylists, filepath.Join(outputDir, rendition.Name, "playlist.m3u8"))
+	}
+	if audio != nil {
+		spec.AudioPlaylist = filepath.Join(outputDir, audio.Name, "playlist.m3u8")
+	}
+
+	if err := h.Transcoder.PackageDASH(ctx, spec); err != nil {
+		return fmt.Errorf("DASH packaging failed: %w", err)
+	}
+	return nil
+}
+
+// writeSharedManifest writes a DASH manifest that points at the fMP4 segments
+// of the HLS renditions, so both formats are served from the same objects.
+func writeSharedManifest(dashDir string, renditions []renditionInfo, audio *renditionInfo) error {
+	// Players only switch between representations of one codec, so every
+	// video codec gets its own adaptation set
+	var adaptationSets []dash.AdaptationSet
+	videoSets := map[string]int{}
+	var duration float64
+	for _, rendition := range renditions {
+		duration = max(duration, rendition.Playlist.Duration())
+
+		family := ""
+		if len(rendition.Codecs) > 0 {
+			family, _, _ = strings.Cut(rendition.Codecs[0], ".")
+		}
+		i, ok := videoSets[family]
+		if !ok {
+			i = len(adaptationSets)
+			videoSets[family] = i
+			adaptationSets = append(adaptationSets, dash.AdaptationSet{ContentType: "video", MimeType: "video/mp4"})
+		}
+		adaptationSets[i].Representations = append(adaptationSets[i].Representations, sharedRepresentation(rendition))
+	}
+
+	if audio != nil {
+		adaptationSets = append(adaptationSets, dash.AdaptationSet{
+			ContentType:     "audio",
+			MimeType:        "audio/mp4",
+			Representations: []dash.Representation{sharedRepresentation(*audio)},
+		})
+	}
+
+	file, err := os.Create(filepath.Join(dashDir, "manifest.mpd"))
+	if err != nil {
+		return transientError("failed to create DASH manifest: %v", err)
+	}
+	defer file.Close()
+
+	if err := dash.Write(file, duration, adaptationSets); err != nil {
+		return transientError("failed to write DASH manifest: %v", err)
+	}
+	return nil
+}
+
+// sharedRepresentation points a DASH representation at the segments of an
+// HLS rendition. Their URIs are relative to the rendition, the manifest lives
+// in dash/.
+func sharedRepresentation(rendition renditionInfo) dash.Representation {
+	representation := dash.Representation{
+		ID:        rendition.Name,
+		Bandwidth: rendition.PeakBandwidth,
+		Codecs:    strings.Join(rendition.Codecs, ","),
+		Width:     rendition.Width,
+		Height:    rendition.Height,
+		FrameRate: rendition.FrameRate,
+		InitURI:   path.Join("..", rendition.Name, rendition.Playlist.InitURI),
+	}
+	for _, segment := range rendition.Playlist.Segments {
+		representation.Segments = append(representation.Segments, dash.Segment{
+			URI:      path.Join("..", rendition.Name, segment.URI),
+			Duration: segment.Duration,
+		})
+	}
+	return representation
+}
+
+// isPublishedFile reports whether a file in the output directory belongs to
+// an output format enabled for this deployment.
+func (h *HLSBackgroundJob) isPublishedFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ts", ".m3u8":
+		return h.Cfg.Env.OutputEnabled("hls")
+	case ".mpd":
+		return h.Cfg.Env.OutputEnabled("dash")
+	case ".m4s", ".mp4":
+		// fMP4 renditions are shared by HLS and DASH
+		return h.Cfg.Env.OutputEnabled("dash") ||
+			(h.Cfg.Env.OutputEnabled("hls") && h.Cfg.Env.HLS_SEGMENT_TYPE == "fmp4")
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"video-feed/pkg/m3u8"
+)
+
+var ErrKeyNotFound = errors.New("key not found")
+
+// createKeys returns the AES-128 keys of a video, a new key starts every
+// HLS_KEY_ROTATION segments. Keys of an earlier attempt are reused since
+// renditions it published are encrypted with them, only missing keys are
+// generated. Keys only live in the database, players fetch them from the
+// authenticated key endpoint.
+func (h *HLSBackgroundJob) createKeys(videoID string, duration float64) ([][]byte, error) {
+	rotation := h.Cfg.Env.HLS_KEY_ROTATION
+
+	// Segments are cut on the first keyframe after hlsSegmentDuration, so no
+	// rendition has more segments than this
+	segmentCount := int(math.Ceil(duration/hlsSegmentDuration)) + 1
+	keyCount := 1
+	if rotation > 0 && segmentCount > rotation {
+		keyCount = (segmentCount + rotation - 1) / rotation
+	}
+
+	keys, err := h.KeyRepo.List(videoID)
+	if err != nil {
+		return nil, transientError("failed to load keys: %v", err)
+	}
+	if len(keys) >= keyCount {
+		return keys, nil
+	}
+
+	missing := make([][]byte, keyCount-len(keys))
+	for i := range missing {
+		missing[i] = make([]byte, aes.BlockSize)
+		if _, err := rand.Read(missing[i]); err != nil {
+			return nil, transientError("failed to generate key: %v", err)
+		}
+	}
+	if err := h.KeyRepo.Append(videoID, missing); err != nil {
+		return nil, transientError("failed to store keys: %v", err)
+	}
+	return append(keys, missing...), nil
+}
+
+// encryptRenditions encrypts every segment of the renditions in place with
+// AES-128 and adds EXT-X-KEY tags to their playlists.
+func (h *HLSBackgroundJob) encryptRenditions(videoID, outputDir string, renditions []renditionInfo, keys [][]byte) error {
+	rotation := h.Cfg.Env.HLS_KEY_ROTATION
+
+	for _, rendition := range renditions {
+		dir := filepath.Join(outputDir, rendition.Name)
+		iv := make([]byte, aes.BlockSize)
+
+		for i := range rendition.Playlist.Segments {
+			segment := &rendition.Playlist.Segments[i]
+			keyIndex := 0
+			if rotation > 0 {
+				keyIndex = min(i/rotation, len(keys)-1)
+			}
+
+			// Every key period gets a fresh IV, written next to the key URI
+			if i == 0 || (rotation > 0 && i%rotation == 0) {
+				if _, err := rand.Read(iv); err != nil {
+					return transientError("failed to generate IV: %v", err)
+				}
+				segment.Key = &m3u8.Key{
+					Method: "AES-128",
+					URI:    h.keyURI(videoID, keyIndex),
+					IV:     "0x" + hex.EncodeToString(iv),
+				}
+			}
+
+			if err := encryptFile(filepath.Join(dir, segment.URI), keys[keyIndex], iv); err != nil {
+				return transientError("failed to encrypt %s segment: %v", rendition.Name, err)
+			}
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, "playlist.m3u8"), rendition.Playlist.Bytes(), 0644); err != nil {
+			return transientError("failed to write %s playlist: %v", rendition.Name, err)
+		}
+	}
+	return nil
+}
+
+func (h *HLSBackgroundJob) keyURI(videoID string, index int) string {
+	return fmt.Sprintf("%s/api/keys/%s?key=%d", h.Cfg.Env.APP_URL, videoID, index)
+}
+
+// encryptFile encrypts a whole segment with AES-128-CBC and PKCS#7 padding,
+// as the AES-128 method of HLS expects.
+func encryptFile(path string, key, iv []byte) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	data = append(data, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	return os.WriteFile(path, data, 0644)
+}
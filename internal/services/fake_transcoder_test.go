@@ -0,0 +1,230 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"video-feed/config"
+	"video-feed/internal/models"
+	"video-feed/pkg/m3u8"
+)
+
+// Output sizes are scaled down from the real bitrates to keep fake files small
+const fakeSizeDivisor = 1000
+
+// Profile names ffprobe reports for the profiles of the ladder
+var fakeProfiles = map[string]string{
+	"baseline": "Constrained Baseline",
+	"main":     "Main",
+	"high":     "High",
+	"main10":   "Main 10",
+}
+
+// Codec names and levels ffprobe reports for the codecs of the ladder
+var fakeCodecs = map[string]struct {
+	Name  string
+	Level int
+}{
+	"h264": {"h264", 31},
+	"h265": {"hevc", 93},
+	"av1":  {"av1", 8},
+}
+
+// FakeTranscoder writes deterministic playlists, segments and images instead
+// of running ffmpeg, so the pipeline can run in tests. Every rendition is as
+// long as Info.Duration.
+type FakeTranscoder struct {
+	Info   models.MediaInfo
+	Silent bool
+	// SampleBitrate is what MeasureComplexity reports
+	SampleBitrate int
+	// Scenes are the frames SceneScores picks from
+	Scenes []SceneScore
+	// ProbeErr and EncodeErr make Probe and the encodes fail
+	ProbeErr  error
+	EncodeErr error
+
+	mu      sync.Mutex
+	encoded map[string]RenditionSpec
+}
+
+func NewFakeTranscoder(info models.MediaInfo) *FakeTranscoder {
+	return &FakeTranscoder{Info: info, SampleBitrate: 2500000, encoded: map[string]RenditionSpec{}}
+}
+
+func (t *FakeTranscoder) Probe(ctx context.Context, inputPath string) (models.MediaInfo, error) {
+	if t.ProbeErr != nil {
+		return models.MediaInfo{}, t.ProbeErr
+	}
+	return t.Info, nil
+}
+
+// ProbeStreams reports the streams EncodeRendition wrote to the playlist's directory.
+func (t *FakeTranscoder) ProbeStreams(ctx context.Context, playlistPath string) ([]StreamInfo, error) {
+	t.mu.Lock()
+	spec, ok := t.encoded[filepath.Dir(playlistPath)]
+	t.mu.Unlock()
+	if !ok {
+		return nil, transientError("no rendition was encoded to %s", filepath.Dir(playlistPath))
+	}
+
+	var streams []StreamInfo
+	if rung := spec.Video; rung != nil {
+		width := rung.Height
+		if t.Info.DisplayHeight() > 0 {
+			width = int(math.Round(float64(rung.Height*t.Info.DisplayWidth())/float64(t.Info.DisplayHeight())/2)) * 2
+		}
+		codec, ok := fakeCodecs[rung.Codec]
+		if !ok {
+			codec = fakeCodecs["h264"]
+		}
+		bitDepth := 8
+		if rung.Profile == "main10" {
+			bitDepth = 10
+		}
+		streams = append(streams, StreamInfo{
+			CodecType: "video",
+			CodecName: codec.Name,
+			Profile:   fakeProfiles[rung.Profile],
+			Level:     codec.Level,
+			Width:     width,
+			Height:    rung.Height,
+			FrameRate: t.Info.FrameRate,
+			BitDepth:  bitDepth,
+		})
+	}
+	if spec.AudioBitrate != "" {
+		streams = append(streams, StreamInfo{CodecType: "audio", CodecName: "aac", Profile: "LC"})
+	}
+	return streams, nil
+}
+
+func (t *FakeTranscoder) DetectSilence(ctx context.Context, inputPath string) (bool, error) {
+	return t.Silent, nil
+}
+
+func (t *FakeTranscoder) MeasureComplexity(ctx context.Context, inputPath string, spec ComplexitySpec) (int, error) {
+	if t.ProbeErr != nil {
+		return 0, t.ProbeErr
+	}
+	return t.SampleBitrate, nil
+}
+
+// SceneScores returns the Scenes inside the window that pass the threshold.
+func (t *FakeTranscoder) SceneScores(ctx context.Context, inputPath string, spec SceneSpec) ([]SceneScore, error) {
+	var scores []SceneScore
+	for _, scene := range t.Scenes {
+		if scene.Time >= spec.Seek && scene.Time < spec.Seek+spec.Duration && scene.Score > spec.Threshold {
+			scores = append(scores, scene)
+		}
+	}
+	return scores, nil
+}
+
+// EncodeRendition writes one segment per SegmentDuration. Segment n of a
+// rendition is filled with byte n and sized after the rendition's bitrate.
+func (t *FakeTranscoder) EncodeRendition(ctx context.Context, inputPath string, spec RenditionSpec) error {
+	if t.EncodeErr != nil {
+		return t.EncodeErr
+	}
+
+	var bitrate int
+	if spec.Video != nil {
+		videoBitrate, _ := config.ParseBitrate(spec.Video.VideoBitrate)
+		bitrate += videoBitrate
+	}
+	if spec.AudioBitrate != "" {
+		audioBitrate, _ := config.ParseBitrate(spec.AudioBitrate)
+		bitrate += audioBitrate
+	}
+
+	playlist := m3u8.MediaPlaylist{Version: 3, TargetDuration: spec.SegmentDuration}
+	extension := ".ts"
+	if spec.SegmentType == "fmp4" {
+		playlist.Version = 7
+		playlist.InitURI = "init.mp4"
+		extension = ".m4s"
+		if err := os.WriteFile(filepath.Join(spec.OutputDir, "init.mp4"), []byte("fake init segment"), 0644); err != nil {
+			return err
+		}
+	}
+
+	remaining := t.Info.Duration
+	for n := 0; remaining > 0; n++ {
+		duration := math.Min(float64(spec.SegmentDuration), remaining)
+		remaining -= duration
+
+		name := fmt.Sprintf("segment%03d%s", n, extension)
+		size := int(float64(bitrate)*duration/8/fakeSizeDivisor) + 1
+		if err := os.WriteFile(filepath.Join(spec.OutputDir, name), bytes.Repeat([]byte{byte(n)}, size), 0644); err != nil {
+			return err
+		}
+		playlist.Segments = append(playlist.Segments, m3u8.Segment{URI: name, Duration: duration})
+		if spec.Progress != nil {
+			spec.Progress(t.Info.Duration - remaining)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(spec.OutputDir, "playlist.m3u8"), playlist.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.encoded[spec.OutputDir] = spec
+	t.mu.Unlock()
+	return nil
+}
+
+// EncodeLadder encodes the rungs one after another and lists them in a master
+// playlist like ffmpeg's -master_pl_name.
+func (t *FakeTranscoder) EncodeLadder(ctx context.Context, inputPath string, spec LadderSpec) error {
+	master := m3u8.MasterPlaylist{Version: 3}
+	for _, rung := range spec.Rungs {
+		rung := rung
+		dir := filepath.Join(spec.OutputDir, rung.Name)
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return err
+		}
+
+		err := t.EncodeRendition(ctx, inputPath, RenditionSpec{
+			OutputDir:       dir,
+			Video:           &rung,
+			SegmentType:     spec.SegmentType,
+			SegmentDuration: spec.SegmentDuration,
+			GOPSize:         spec.GOPSize,
+		})
+		if err != nil {
+			return err
+		}
+
+		bandwidth, _ := config.ParseBitrate(rung.MaxRate)
+		master.Variants = append(master.Variants, m3u8.Variant{URI: rung.Name + "/playlist.m3u8", Bandwidth: int64(bandwidth)})
+	}
+
+	// All rungs advance together in a single encode
+	if spec.Progress != nil {
+		spec.Progress(t.Info.Duration)
+	}
+	return os.WriteFile(filepath.Join(spec.OutputDir, "master.m3u8"), master.Bytes(), 0644)
+}
+
+// ExtractFrames writes a single placeholder image naming the seek and filter,
+// patterns get frame 1.
+func (t *FakeTranscoder) ExtractFrames(ctx context.Context, inputPath string, spec FrameSpec) error {
+	outputPath := spec.OutputPath
+	if strings.Contains(outputPath, "%") {
+		outputPath = fmt.Sprintf(outputPath, 1)
+	}
+	return os.WriteFile(outputPath, []byte(fmt.Sprintf("fake frame at %.3f: %s", spec.Seek, spec.Filter)), 0644)
+}
+
+func (t *FakeTranscoder) PackageDASH(ctx context.Context, spec DASHSpec) error {
+	manifest := fmt.Sprintf("<?xml version=\"1.0\"?>\n<MPD xmlns=\"urn:mpeg:dash:schema:mpd:2011\" type=\"static\"><!-- %d video, audio %t --></MPD>\n",
+		len(spec.VideoPlaylists), spec.AudioPlaylist != "")
+	return os.WriteFile(spec.ManifestPath, []byte(manifest), 0644)
+}
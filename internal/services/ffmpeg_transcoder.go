@@ -0,0 +1,598 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"video-feed/config"
+	"video-feed/internal/models"
+	"video-feed/pkg/m3u8"
+)
+
+// Digital silence, volumedetect reports -91 dB for all zero samples
+const silenceThreshold = -90.0
+
+var maxVolumePattern = regexp.MustCompile(`max_volume: (-?[0-9.]+|-inf) dB`)
+
+// Frame headers the metadata filter prints before the frame's scene score
+var frameTimePattern = regexp.MustCompile(`pts_time:(-?[0-9.]+)`)
+
+// FFmpegTranscoder runs the ffmpeg and ffprobe binaries found in PATH.
+type FFmpegTranscoder struct{}
+
+func NewFFmpegTranscoder() *FFmpegTranscoder {
+	return &FFmpegTranscoder{}
+}
+
+type ffprobeOutput struct {
+	Streams []ffprobeStream `json:"streams"`
+	Format  struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+type ffprobeStream struct {
+	CodecType    string            `json:"codec_type"`
+	CodecName    string            `json:"codec_name"`
+	Profile      string            `json:"profile"`
+	Level        int               `json:"level"`
+	Width        int               `json:"width"`
+	Height       int               `json:"height"`
+	AvgFrameRate string            `json:"avg_frame_rate"`
+	RFrameRate   string            `json:"r_frame_rate"`
+	PixFmt       string            `json:"pix_fmt"`
+	Tags         map[string]string `json:"tags"`
+	SideDataList []struct {
+		Rotation float64 `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+// Probe runs ffprobe on the input and rejects files we cannot transcode.
+func (t *FFmpegTranscoder) Probe(ctx context.Context, inputPath string) (models.MediaInfo, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		inputPath,
+	)
+	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		return models.MediaInfo{}, transientError("FFprobe timed out: %v", ctx.Err())
+	}
+	if killedBySignal(err) {
+		return models.MediaInfo{}, transientError("FFprobe was killed: %v", err)
+	}
+	if err != nil {
+		return models.MediaInfo{}, permanentError("FFprobe failed, input is not a media file: %v", err)
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return models.MediaInfo{}, permanentError("failed to parse FFprobe output: %v", err)
+	}
+
+	info := models.MediaInfo{
+		Format: probe.Format.FormatName,
+	}
+	info.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	info.Bitrate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+
+	for _, stream := range probe.Streams {
+		switch {
+		case stream.CodecType == "video" && info.VideoCodec == "":
+			info.VideoCodec = stream.CodecName
+			info.Width = stream.Width
+			info.Height = stream.Height
+			info.FrameRate = parseFrameRate(stream.AvgFrameRate)
+			if info.FrameRate == 0 {
+				info.FrameRate = parseFrameRate(stream.RFrameRate)
+			}
+			info.Rotation = streamRotation(stream)
+		case stream.CodecType == "audio" && info.AudioCodec == "":
+			info.AudioCodec = stream.CodecName
+		}
+	}
+
+	switch {
+	case info.VideoCodec == "":
+		return info, permanentError("input has no video stream")
+	case info.Width <= 0 || info.Height <= 0:
+		return info, permanentError("input has an invalid resolution %dx%d", info.Width, info.Height)
+	case info.Duration <= 0:
+		return info, permanentError("input has no duration, it is not a video")
+	}
+	return info, nil
+}
+
+func (t *FFmpegTranscoder) ProbeStreams(ctx context.Context, playlistPath string) ([]StreamInfo, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_streams",
+		playlistPath,
+	)
+	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, transientError("FFprobe timed out: %v", ctx.Err())
+	}
+	if err != nil {
+		return nil, transientError("FFprobe failed on %s: %v", playlistPath, err)
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, transientError("failed to parse FFprobe output: %v", err)
+	}
+
+	streams := make([]StreamInfo, 0, len(probe.Streams))
+	for _, stream := range probe.Streams {
+		info := StreamInfo{
+			CodecType: stream.CodecType,
+			CodecName: stream.CodecName,
+			Profile:   stream.Profile,
+			Level:     stream.Level,
+			Width:     stream.Width,
+			Height:    stream.Height,
+			FrameRate: parseFrameRate(stream.AvgFrameRate),
+			BitDepth:  pixFmtBitDepth(stream.PixFmt),
+		}
+		if info.FrameRate == 0 {
+			info.FrameRate = parseFrameRate(stream.RFrameRate)
+		}
+		streams = append(streams, info)
+	}
+	return streams, nil
+}
+
+// DetectSilence catches screen recordings and muted exports that carry an
+// audio stream with nothing in it.
+func (t *FFmpegTranscoder) DetectSilence(ctx context.Context, inputPath string) (bool, error) {
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner",
+		"-i", inputPath,
+		"-map", "0:a:0",
+		"-af", "volumedetect",
+		"-f", "null", "-",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return false, ffmpegError(ctx, "FFmpeg failed to decode audio", err, output)
+	}
+
+	match := maxVolumePattern.FindSubmatch(output)
+	if match == nil {
+		return false, nil
+	}
+	if string(match[1]) == "-inf" {
+		return true, nil
+	}
+	maxVolume, err := strconv.ParseFloat(string(match[1]), 64)
+	return err == nil && maxVolume <= silenceThreshold, nil
+}
+
+// MeasureComplexity encodes every sample with x264 in CRF mode, which spends
+// as many bits as the content needs for that quality, and sums the file sizes.
+func (t *FFmpegTranscoder) MeasureComplexity(ctx context.Context, inputPath string, spec ComplexitySpec) (int, error) {
+	var bits, seconds float64
+	for i, start := range spec.Samples {
+		samplePath := filepath.Join(spec.WorkDir, fmt.Sprintf("complexity_%02d.mp4", i))
+		err := runFFmpeg(ctx,
+			"-y",
+			"-ss", strconv.FormatFloat(start, 'f', 3, 64),
+			"-t", strconv.FormatFloat(spec.SampleDuration, 'f', 3, 64),
+			"-i", inputPath,
+			"-map", "0:v:0",
+			"-an",
+			"-vf", fmt.Sprintf("scale=-2:%d", spec.Height),
+			"-c:v", "libx264",
+			"-preset", "veryfast",
+			"-crf", strconv.Itoa(spec.CRF),
+			samplePath,
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		info, err := os.Stat(samplePath)
+		os.Remove(samplePath)
+		if err != nil {
+			return 0, transientError("failed to measure complexity sample: %v", err)
+		}
+		bits += float64(info.Size()) * 8
+		seconds += spec.SampleDuration
+	}
+
+	if seconds == 0 {
+		return 0, permanentError("complexity analysis has no samples")
+	}
+	return int(bits / seconds), nil
+}
+
+func (t *FFmpegTranscoder) EncodeRendition(ctx context.Context, inputPath string, spec RenditionSpec) error {
+	args := []string{"-i", inputPath}
+
+	if rung := spec.Video; rung != nil {
+		args = append(args,
+			"-map", "0:v:0",
+			"-vf", fmt.Sprintf("scale=-2:%d", rung.Height),
+		)
+		args = append(args, videoCodecArgs(*rung, "v:0")...)
+		args = append(args, keyframeArgs(spec.GOPSize)...)
+	} else {
+		args = append(args, "-vn")
+	}
+
+	if spec.AudioBitrate != "" {
+		args = append(args,
+			"-map", "0:a:0",
+			"-c:a", "aac",
+			"-b:a", spec.AudioBitrate,
+			"-ac", "2",
+		)
+	} else {
+		args = append(args, "-an")
+	}
+
+	args = append(args, hlsArgs(spec.OutputDir, spec.SegmentType, spec.SegmentDuration)...)
+
+	// ffmpeg exits non-zero on inputs it cannot decode, retrying will not help
+	if spec.Progress != nil {
+		return runFFmpegWithProgress(ctx, spec.Progress, args...)
+	}
+	return runFFmpeg(ctx, args...)
+}
+
+// EncodeLadder splits the decoded video into one scaler per rung, and the hls
+// muxer writes a variant per rung through -var_stream_map.
+func (t *FFmpegTranscoder) EncodeLadder(ctx context.Context, inputPath string, spec LadderSpec) error {
+	if len(spec.Rungs) == 0 {
+		return permanentError("ladder has no rungs to encode")
+	}
+
+	filters := []string{fmt.Sprintf("[0:v:0]split=%d", len(spec.Rungs))}
+	for i := range spec.Rungs {
+		filters[0] += fmt.Sprintf("[s%d]", i)
+	}
+	streamMap := make([]string, len(spec.Rungs))
+	for i, rung := range spec.Rungs {
+		filters = append(filters, fmt.Sprintf("[s%d]scale=-2:%d[v%d]", i, rung.Height, i))
+		streamMap[i] = fmt.Sprintf("v:%d,name:%s", i, rung.Name)
+	}
+
+	args := []string{"-i", inputPath, "-filter_complex", strings.Join(filters, ";")}
+	for i := range spec.Rungs {
+		args = append(args, "-map", fmt.Sprintf("[v%d]", i))
+	}
+
+	for i, rung := range spec.Rungs {
+		args = append(args, videoCodecArgs(rung, fmt.Sprintf("v:%d", i))...)
+	}
+	args = append(args, keyframeArgs(spec.GOPSize)...)
+	args = append(args,
+		"-an",
+		"-var_stream_map", strings.Join(streamMap, " "),
+		// Written one level above the %v directories
+		"-master_pl_name", "master.m3u8",
+	)
+	args = append(args, hlsArgs(filepath.Join(spec.OutputDir, "%v"), spec.SegmentType, spec.SegmentDuration)...)
+
+	var err error
+	if spec.Progress != nil {
+		err = runFFmpegWithProgress(ctx, spec.Progress, args...)
+	} else {
+		err = runFFmpeg(ctx, args...)
+	}
+	if err != nil {
+		return err
+	}
+	return checkLadderMaster(spec)
+}
+
+// checkLadderMaster makes sure ffmpeg wrote a variant for every rung, a bad
+// -var_stream_map is not always an ffmpeg error.
+func checkLadderMaster(spec LadderSpec) error {
+	file, err := os.Open(filepath.Join(spec.OutputDir, "master.m3u8"))
+	if err != nil {
+		return transientError("failed to read ladder master playlist: %v", err)
+	}
+	defer file.Close()
+
+	master, err := m3u8.ParseMasterPlaylist(file)
+	if err != nil {
+		return transientError("failed to parse ladder master playlist: %v", err)
+	}
+
+	written := map[string]bool{}
+	for _, variant := range master.Variants {
+		written[variant.URI] = true
+	}
+	for _, rung := range spec.Rungs {
+		if !written[rung.Name+"/playlist.m3u8"] {
+			return transientError("FFmpeg wrote no variant for rung %s", rung.Name)
+		}
+	}
+	return nil
+}
+
+// Software encoders by ladder codec, they all run on CPU-only workers
+var videoEncoders = map[string]string{
+	"h264": "libx264",
+	"h265": "libx265",
+	"av1":  "libsvtav1",
+}
+
+// videoCodecArgs configures the encoder of the output stream selected by
+// stream, like v:1.
+func videoCodecArgs(rung config.LadderRung, stream string) []string {
+	encoder, ok := videoEncoders[rung.Codec]
+	if !ok {
+		encoder = videoEncoders["h264"]
+	}
+
+	args := []string{
+		"-c:" + stream, encoder,
+		"-b:" + stream, rung.VideoBitrate,
+		"-maxrate:" + stream, rung.MaxRate,
+		"-bufsize:" + stream, rung.BufSize,
+	}
+	switch rung.Codec {
+	case "h265":
+		args = append(args,
+			"-profile:"+stream, rung.Profile,
+			// Apple players only accept HEVC tagged hvc1. x265 ignores
+			// -sc_threshold and needs closed GOPs for clean switching.
+			"-tag:"+stream, "hvc1",
+			"-x265-params:"+stream, "scenecut=0:open-gop=0",
+		)
+		if rung.Profile == "main10" {
+			args = append(args, "-pix_fmt:"+stream, "yuv420p10le")
+		}
+	case "av1":
+		// Preset 8 keeps SVT-AV1 near real time, scene change keyframes stay off
+		args = append(args,
+			"-preset:"+stream, "8",
+			"-svtav1-params:"+stream, "scd=0",
+		)
+	default:
+		args = append(args, "-profile:"+stream, rung.Profile)
+	}
+	return args
+}
+
+// keyframeArgs places a keyframe every gopSize frames and nowhere else, so
+// renditions encoded with the same size switch cleanly on segment boundaries.
+func keyframeArgs(gopSize int) []string {
+	if gopSize <= 0 {
+		return nil
+	}
+	return []string{
+		"-g", strconv.Itoa(gopSize),
+		"-keyint_min", strconv.Itoa(gopSize),
+		"-sc_threshold", "0",
+	}
+}
+
+// hlsArgs writes playlist.m3u8 and its segments into outputDir, which may
+// hold the %v variant placeholder.
+func hlsArgs(outputDir, segmentType string, segmentDuration int) []string {
+	args := []string{
+		"-start_number", "0",
+		"-hls_time", strconv.Itoa(segmentDuration),
+		"-hls_list_size", "0",
+		"-f", "hls",
+	}
+
+	// ffmpeg writes the init segment next to the playlist and bumps it to
+	// version 7. With several variants it suffixes the name with the variant
+	// index, playlists reference whatever name it picked.
+	segmentPath := filepath.Join(outputDir, "segment%03d.ts")
+	if segmentType == "fmp4" {
+		segmentPath = filepath.Join(outputDir, "segment%03d.m4s")
+		args = append(args,
+			"-hls_segment_type", "fmp4",
+			"-hls_fmp4_init_filename", "init.mp4",
+		)
+	}
+
+	return append(args,
+		"-hls_segment_filename", segmentPath,
+		filepath.Join(outputDir, "playlist.m3u8"),
+	)
+}
+
+// SceneScores selects frames with the scene filter and prints their scores
+// with the metadata filter. Input seeking restarts timestamps at 0, so the
+// printed times are offset by the seek.
+func (t *FFmpegTranscoder) SceneScores(ctx context.Context, inputPath string, spec SceneSpec) ([]SceneScore, error) {
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner",
+		"-ss", strconv.FormatFloat(spec.Seek, 'f', 3, 64),
+		"-t", strconv.FormatFloat(spec.Duration, 'f', 3, 64),
+		"-i", inputPath,
+		"-map", "0:v:0",
+		"-an",
+		"-vf", fmt.Sprintf("select='gt(scene,%g)',metadata=print:file=-", spec.Threshold),
+		"-f", "null", "-",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, ffmpegError(ctx, "FFmpeg failed to score scenes", err, stderr.Bytes())
+	}
+
+	var scores []SceneScore
+	var frameTime float64
+	for _, line := range strings.Split(string(output), "\n") {
+		if match := frameTimePattern.FindStringSubmatch(line); match != nil {
+			frameTime, _ = strconv.ParseFloat(match[1], 64)
+			continue
+		}
+		if value, found := strings.CutPrefix(strings.TrimSpace(line), "lavfi.scene_score="); found {
+			score, err := strconv.ParseFloat(value, 64)
+			if err == nil {
+				scores = append(scores, SceneScore{Time: spec.Seek + frameTime, Score: score})
+			}
+		}
+	}
+	return scores, nil
+}
+
+func (t *FFmpegTranscoder) ExtractFrames(ctx context.Context, inputPath string, spec FrameSpec) error {
+	args := []string{"-y"}
+	if spec.Seek > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(spec.Seek, 'f', 3, 64))
+	}
+	args = append(args, "-i", inputPath)
+	if spec.Filter != "" {
+		args = append(args, "-vf", spec.Filter)
+	}
+	if spec.MaxFrames > 0 {
+		args = append(args, "-frames:v", strconv.Itoa(spec.MaxFrames))
+	}
+
+	if spec.Quality > 0 {
+		switch strings.ToLower(filepath.Ext(spec.OutputPath)) {
+		case ".webp":
+			args = append(args, "-quality", strconv.Itoa(spec.Quality))
+		default:
+			args = append(args, "-q:v", strconv.Itoa(spec.Quality))
+		}
+	}
+
+	return runFFmpeg(ctx, append(args, spec.OutputPath)...)
+}
+
+// PackageDASH lists segments explicitly (SegmentList) so the manifest can be
+// signed per segment.
+func (t *FFmpegTranscoder) PackageDASH(ctx context.Context, spec DASHSpec) error {
+	var args []string
+	for _, playlist := range spec.VideoPlaylists {
+		args = append(args, "-i", playlist)
+	}
+	for i := range spec.VideoPlaylists {
+		args = append(args, "-map", fmt.Sprintf("%d:v:0", i))
+	}
+
+	adaptationSets := "id=0,streams=v"
+	if spec.AudioPlaylist != "" {
+		args = append(args,
+			"-i", spec.AudioPlaylist,
+			"-map", fmt.Sprintf("%d:a:0", len(spec.VideoPlaylists)),
+		)
+		adaptationSets += " id=1,streams=a"
+	}
+
+	args = append(args,
+		"-c", "copy",
+		"-f", "dash",
+		"-seg_duration", strconv.Itoa(spec.SegmentDuration),
+		"-use_template", "0",
+		"-use_timeline", "0",
+		"-adaptation_sets", adaptationSets,
+		"-init_seg_name", "init-$RepresentationID$.m4s",
+		"-media_seg_name", "segment-$RepresentationID$-$Number%05d$.m4s",
+		spec.ManifestPath,
+	)
+
+	return runFFmpeg(ctx, args...)
+}
+
+// runFFmpeg runs ffmpeg and classifies its failure, a timeout may pass on
+// retry while a decode error will not.
+func runFFmpeg(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return ffmpegError(ctx, "FFmpeg failed", err, output)
+	}
+	return nil
+}
+
+// runFFmpegWithProgress reads the -progress key=value stream from stdout and
+// reports out_time, the position of the output, as ffmpeg advances.
+func runFFmpegWithProgress(ctx context.Context, progress func(encoded float64), args ...string) error {
+	args = append([]string{"-progress", "pipe:1", "-nostats"}, args...)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return transientError("failed to read FFmpeg progress: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return transientError("failed to start FFmpeg: %v", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+		// out_time_ms is in microseconds as well, older versions only write it
+		if key != "out_time_us" && key != "out_time_ms" {
+			continue
+		}
+		if microseconds, err := strconv.ParseInt(value, 10, 64); err == nil && microseconds >= 0 {
+			progress(float64(microseconds) / 1e6)
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return ffmpegError(ctx, "FFmpeg failed", err, stderr.Bytes())
+	}
+	return nil
+}
+
+// pixFmtBitDepth reads the bit depth from a pixel format like yuv420p10le.
+func pixFmtBitDepth(pixFmt string) int {
+	switch {
+	case strings.Contains(pixFmt, "p10"):
+		return 10
+	case strings.Contains(pixFmt, "p12"):
+		return 12
+	}
+	return 8
+}
+
+// parseFrameRate parses ffprobe rationals like "30000/1001".
+func parseFrameRate(rate string) float64 {
+	num, den, found := strings.Cut(rate, "/")
+	if !found {
+		value, _ := strconv.ParseFloat(rate, 64)
+		return value
+	}
+
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return math.Round(n/d*1000) / 1000
+}
+
+// streamRotation reads the rotation from the display matrix, or the rotate
+// tag older ffprobe versions report, normalized to 0, 90, 180 or 270.
+func streamRotation(stream ffprobeStream) int {
+	rotation := 0
+	if value, ok := stream.Tags["rotate"]; ok {
+		rotation, _ = strconv.Atoi(value)
+	}
+	for _, sideData := range stream.SideDataList {
+		if sideData.Rotation != 0 {
+			rotation = int(sideData.Rotation)
+		}
+	}
+	return ((rotation % 360) + 360) % 360
+}
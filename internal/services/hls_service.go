@@ -4,52 +4,97 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
+	"slices"
 	"time"
 	"video-feed/config"
-	"video-feed/internal/repositories"
+	"video-feed/internal/models"
+	"video-feed/pkg/m3u8"
 	"video-feed/pkg/storage"
 )
 
+const (
+	audioGroupID = "audio"
+	// Target segment length in seconds, ffmpeg cuts on the next keyframe
+	hlsSegmentDuration = 10
+	// Keyframe interval in seconds, it divides hlsSegmentDuration so every
+	// variant cuts its segments on the same frames
+	hlsKeyframeInterval = 2
+)
+
+// VideoStore is what the pipeline reads and writes of a video, implemented
+// by repositories.VideoRepository.
+type VideoStore interface {
+	GetVideoByID(videoID string) (*models.Video, error)
+	UpdateMediaInfo(videoID string, info models.MediaInfo) error
+	UpdateThumbnailURL(videoID, thumbnailURL string) error
+	UpdateSpriteVTTURL(videoID, spriteVTTURL string) error
+	UpdateRenditions(videoID string, renditions map[string]models.RenditionState) error
+	PublishRenditions(videoID string, renditions map[string]models.RenditionState, qualities []string, hlsURL string) error
+	UpdateVideoProcessingStatus(videoID string, processed bool, processingError string, qualities []string, hlsURL string, dashURL string) error
+	MarkCancelled(videoID string) error
+}
+
+// SubtitleLister lists the subtitle tracks published with a video.
+type SubtitleLister interface {
+	ListByVideo(videoID string) ([]models.Subtitle, error)
+}
+
+// KeyStore keeps the AES-128 keys of a video.
+type KeyStore interface {
+	List(videoID string) ([][]byte, error)
+	Append(videoID string, keys [][]byte) error
+}
+
+// JobStore records what the running job of a video is doing.
+type JobStore interface {
+	UpdateProgress(videoID string, progress map[string]models.RenditionProgress) error
+	UpdateLadder(videoID string, ladder models.LadderChoice) error
+}
+
 type HLSBackgroundJob struct {
-	Cfg     *config.AppConfig
-	Storage storage.StorageService
-	Repo    *repositories.VideoRepository
+	Cfg          *config.AppConfig
+	Storage      storage.StorageService
+	Repo         VideoStore
+	SubtitleRepo SubtitleLister
+	KeyRepo      KeyStore
+	JobRepo      JobStore
+	Transcoder   Transcoder
+	Uploader     *storage.ParallelUploader
+
+	running cancellationRegistry
 }
 
-func NewHLSBackgroundJob(Cfg *config.AppConfig, Storage storage.StorageService, Repo *repositories.VideoRepository) *HLSBackgroundJob {
-	return &HLSBackgroundJob{Cfg: Cfg, Storage: Storage, Repo: Repo}
+func NewHLSBackgroundJob(Cfg *config.AppConfig, Storage storage.StorageService, Repo VideoStore, SubtitleRepo SubtitleLister, KeyRepo KeyStore, JobRepo JobStore, Transcoder Transcoder) *HLSBackgroundJob {
+	uploader := storage.NewParallelUploader(Storage, Cfg.Env.UPLOAD_CONCURRENCY, Cfg.Env.UPLOAD_MAX_ATTEMPTS)
+	return &HLSBackgroundJob{Cfg: Cfg, Storage: Storage, Repo: Repo, SubtitleRepo: SubtitleRepo, KeyRepo: KeyRepo, JobRepo: JobRepo, Transcoder: Transcoder, Uploader: uploader}
 }
 
 type HLSJobResult struct {
 	VideoID string
 	Success bool
 	Error   error
-}
-
-type Resolution struct {
-	Name    string
-	Height  int
-	Bitrate string
-}
-
-var resolutions = []Resolution{
-	{Name: "480p", Height: 480, Bitrate: "1000k"},
-	{Name: "720p", Height: 720, Bitrate: "2500k"},
+	// Qualities lists the rungs that were produced
+	Qualities []string
 }
 
 func (h *HLSBackgroundJob) ProcessHLSWithTimeout(videoID, inputPath string) <-chan HLSJobResult {
 	resultChan := make(chan HLSJobResult, 1)
 
 	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
-		defer cancel()
-		defer close(resultChan)
-
+		// Delivered last, once the output directory is gone and the pipeline
+		// is no longer registered
 		result := HLSJobResult{VideoID: videoID}
+		defer func() {
+			resultChan <- result
+			close(resultChan)
+		}()
+
+		// Registered so the pipeline can be cancelled from outside
+		ctx, cancel := h.running.start(videoID, 30*time.Minute)
+		defer cancel()
 
 		// Create output directory
 		outputDir := fmt.Sprintf("tmp/videos/%s", videoID)
@@ -62,123 +107,385 @@ func (h *HLSBackgroundJob) ProcessHLSWithTimeout(videoID, inputPath string) <-ch
 			}
 		}()
 
-		// Create master playlist
-		masterPlaylist := "#EXTM3U\n#EXT-X-VERSION:3\n"
+		// Probe before transcoding so unsupported inputs fail fast
+		mediaInfo, err := h.Transcoder.Probe(ctx, inputPath)
+		if err != nil {
+			result.Error = err
+			return
+		}
+		if err := h.Repo.UpdateMediaInfo(videoID, mediaInfo); err != nil {
+			log.Printf("Failed to store media info of video %s: %v", videoID, err)
+		}
+
+		// A missing poster should not fail the whole job
+		thumbnailKey, err := h.generateThumbnails(ctx, videoID, inputPath, outputDir, mediaInfo)
+		if err != nil {
+			log.Printf("Failed to generate thumbnails of video %s: %v", videoID, err)
+		} else if err := h.Repo.UpdateThumbnailURL(videoID, thumbnailKey); err != nil {
+			log.Printf("Failed to store thumbnail of video %s: %v", videoID, err)
+		}
+
+		spriteKey, err := h.generateSprites(ctx, videoID, inputPath, outputDir, mediaInfo)
+		if err != nil {
+			log.Printf("Failed to generate sprites of video %s: %v", videoID, err)
+		} else if err := h.Repo.UpdateSpriteVTTURL(videoID, spriteKey); err != nil {
+			log.Printf("Failed to store sprite track of video %s: %v", videoID, err)
+		}
 
-		// Process each resolution
-		for _, res := range resolutions {
-			resPath := filepath.Join(outputDir, res.Name)
-			os.MkdirAll(resPath, os.ModePerm)
+		// Process each rung the source is tall enough for
+		rungs := selectRungs(h.Cfg.Ladder, mediaInfo.DisplayHeight())
+		rungs = h.chooseLadder(ctx, videoID, inputPath, outputDir, rungs, mediaInfo.Duration)
+		planned := make([]string, 0, len(rungs)+1)
+		states := map[string]models.RenditionState{}
+		for _, rung := range rungs {
+			planned = append(planned, rung.Name)
+			states[rung.Name] = models.RenditionPending
+		}
+		if mediaInfo.AudioCodec != "" {
+			planned = append(planned, "audio")
+		}
+		progress := newProgressTracker(h.JobRepo, videoID, mediaInfo.Duration, planned)
+		if err := h.Repo.UpdateRenditions(videoID, states); err != nil {
+			log.Printf("Failed to store rendition states of video %s: %v", videoID, err)
+		}
 
-			if err := h.processQuality(ctx, inputPath, resPath, res.Height, res.Bitrate); err != nil {
-				result.Error = fmt.Errorf("%s conversion failed: %v", res.Name, err)
-				result.Success = false
-				resultChan <- result
+		// Audio goes first, every master playlist published from here on
+		// references the audio group. Sources without audio, or with a silent
+		// track, are published video only.
+		var audio *renditionInfo
+		if mediaInfo.AudioCodec != "" {
+			// The scan only decides whether to drop the track, when it fails
+			// the audio is encoded and its encode reports a broken input
+			silent, err := h.Transcoder.DetectSilence(ctx, inputPath)
+			if ctx.Err() != nil {
+				result.Error = err
 				return
 			}
+			if err != nil {
+				log.Printf("Failed to detect silence in video %s, keeping its audio: %v", videoID, err)
+			}
+
+			if silent {
+				log.Printf("Audio of video %s is silent, publishing it without audio", videoID)
+				progress.complete("audio")
+			} else {
+				// The best rung decides the audio quality every variant gets
+				audioPath := audioDir(outputDir)
+				os.MkdirAll(audioPath, os.ModePerm)
+				if err := h.processAudio(ctx, inputPath, audioPath, rungs[len(rungs)-1].AudioBitrate, progress.reporter("audio")); err != nil {
+					result.Error = fmt.Errorf("audio conversion failed: %w", err)
+					return
+				}
 
-			masterPlaylist += fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%s,RESOLUTION=%dp\n%s/playlist.m3u8\n",
-				strings.TrimSuffix(res.Bitrate, "k")+"000",
-				res.Height,
-				res.Name)
+				rendition, err := h.inspectRendition(ctx, audioPath, "audio")
+				if err != nil {
+					result.Error = err
+					return
+				}
+				audio = &rendition
+				progress.complete("audio")
+			}
 		}
 
-		// Save master playlist
-		masterPlaylistPath := filepath.Join(outputDir, "master.m3u8")
-		if err := os.WriteFile(masterPlaylistPath, []byte(masterPlaylist), 0644); err != nil {
-			result.Error = fmt.Errorf("failed to write master playlist: %v", err)
-			result.Success = false
-			resultChan <- result
-			return
+		// Keys cover the whole video, renditions encrypted later use the same ones
+		var keys [][]byte
+		if h.Cfg.Env.HLS_ENCRYPTION == "aes-128" {
+			keys, err = h.createKeys(videoID, mediaInfo.Duration)
+			if err == nil && audio != nil {
+				err = h.encryptRenditions(videoID, outputDir, []renditionInfo{*audio}, keys)
+			}
+			if err != nil {
+				result.Error = err
+				return
+			}
+		}
+
+		// The lowest H.264 rung is published on its own so the video plays within
+		// seconds, the rest follow from a single decode of the source. Both
+		// encodes use the same GOP size, so keyframes still line up.
+		var renditions []renditionInfo
+		var published []string
+		if audio != nil {
+			published = append(published, audio.Name)
 		}
+		first, rest := splitLadder(rungs)
+		for _, batch := range [][]config.LadderRung{first, rest} {
+			if len(batch) == 0 {
+				continue
+			}
+
+			for _, rung := range batch {
+				states[rung.Name] = models.RenditionEncoding
+			}
+			if err := h.Repo.UpdateRenditions(videoID, states); err != nil {
+				log.Printf("Failed to store rendition states of video %s: %v", videoID, err)
+			}
 
-		// Upload all files to S3
-		err := filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+			encoded, err := h.encodeRenditions(ctx, videoID, inputPath, outputDir, batch, mediaInfo.FrameRate, progress, keys)
 			if err != nil {
-				return err
+				result.Error = err
+				return
+			}
+			renditions = append(renditions, encoded...)
+			for _, rendition := range encoded {
+				result.Qualities = append(result.Qualities, rendition.Name)
+				states[rendition.Name] = models.RenditionReady
+				published = append(published, rendition.Name)
 			}
 
-			if !info.IsDir() && (strings.HasSuffix(path, ".ts") || strings.HasSuffix(path, ".m3u8")) {
-				file, err := os.Open(path)
-				if err != nil {
-					return err
-				}
-				defer file.Close()
+			if err := h.publishMaster(ctx, videoID, outputDir, renditions, audio, published, states, result.Qualities); err != nil {
+				result.Error = err
+				return
+			}
+			// Published directories are not uploaded again
+			published = nil
+		}
 
-				relativePath := strings.TrimPrefix(path, outputDir)
-				minioPath := fmt.Sprintf("videos/%s%s", videoID, relativePath)
-				return h.Storage.UploadObject(minioPath, file)
+		if h.Cfg.Env.OutputEnabled("dash") {
+			if err := h.packageDASH(ctx, outputDir, renditions, audio); err != nil {
+				result.Error = err
+				return
 			}
-			return nil
-		})
 
-		if err != nil {
-			result.Error = fmt.Errorf("upload HLS segments failed: %v", err)
-			result.Success = false
-		} else {
-			result.Success = true
+			// HLS deployments already uploaded the renditions as they were published
+			var roots []string
+			if h.Cfg.Env.OutputEnabled("hls") {
+				roots = []string{"dash"}
+			}
+			if err := h.uploadOutput(ctx, videoID, outputDir, roots...); err != nil {
+				result.Error = transientError("upload DASH output failed: %v", err)
+				return
+			}
 		}
 
-		resultChan <- result
+		result.Success = true
 	}()
 
 	return resultChan
 }
 
-func (h *HLSBackgroundJob) processQuality(ctx context.Context, inputPath, outputDir string, height int, bitrate string) error {
-	playlistPath := filepath.Join(outputDir, "playlist.m3u8")
-	segmentPath := filepath.Join(outputDir, "segment%03d.ts")
+// buildMasterPlaylist describes every variant by what ffmpeg produced. Video
+// variants play with the shared audio group, which is also offered on its own
+// as the last variant for clients on very slow connections.
+func (h *HLSBackgroundJob) buildMasterPlaylist(renditions []renditionInfo, audio *renditionInfo) *m3u8.MasterPlaylist {
+	// fMP4 segments need EXT-X-MAP and so version 7. ffmpeg only cuts
+	// segments on keyframes, so every segment decodes on its own.
+	playlist := &m3u8.MasterPlaylist{Version: 3, IndependentSegments: true}
+	if h.Cfg.Env.HLS_SEGMENT_TYPE == "fmp4" {
+		playlist.Version = 7
+	}
+
+	if audio != nil {
+		playlist.Media = append(playlist.Media, m3u8.Media{
+			Type:       "AUDIO",
+			GroupID:    audioGroupID,
+			Name:       "Audio",
+			Default:    true,
+			AutoSelect: true,
+			Channels:   "2",
+			URI:        audio.Name + "/playlist.m3u8",
+		})
+	}
+
+	for _, rendition := range renditions {
+		variant := m3u8.Variant{
+			URI:              rendition.Name + "/playlist.m3u8",
+			Bandwidth:        rendition.PeakBandwidth,
+			AverageBandwidth: rendition.AverageBandwidth,
+			Codecs:           rendition.Codecs,
+			Width:            rendition.Width,
+			Height:           rendition.Height,
+			FrameRate:        rendition.FrameRate,
+		}
+		if audio != nil {
+			variant.Bandwidth += audio.PeakBandwidth
+			variant.AverageBandwidth += audio.AverageBandwidth
+			variant.Codecs = append(append([]string(nil), rendition.Codecs...), audio.Codecs...)
+			variant.Audio = audioGroupID
+		}
+		playlist.Variants = append(playlist.Variants, variant)
+	}
+
+	if audio != nil {
+		playlist.Variants = append(playlist.Variants, m3u8.Variant{
+			URI:              audio.Name + "/playlist.m3u8",
+			Bandwidth:        audio.PeakBandwidth,
+			AverageBandwidth: audio.AverageBandwidth,
+			Codecs:           audio.Codecs,
+		})
+	}
+	return playlist
+}
+
+// selectRungs drops rungs taller than the source so nothing is upscaled, and
+// sorts them by height with H.264 first. Clients without HEVC or AV1 support
+// always get an H.264 rendition, a source shorter than every H.264 rung gets
+// the lowest one at its own height.
+func selectRungs(ladder []config.LadderRung, sourceHeight int) []config.LadderRung {
+	sorted := append([]config.LadderRung(nil), ladder...)
+	slices.SortStableFunc(sorted, compareRungs)
+
+	var rungs []config.LadderRung
+	for _, rung := range sorted {
+		if sourceHeight <= 0 || rung.Height <= sourceHeight {
+			rungs = append(rungs, rung)
+		}
+	}
+
+	if slices.ContainsFunc(rungs, isH264Rung) {
+		return rungs
+	}
+	if i := slices.IndexFunc(sorted, isH264Rung); i >= 0 {
+		lowest := sorted[i]
+		lowest.Height = sourceHeight - sourceHeight%2
+		rungs = append(rungs, lowest)
+		slices.SortStableFunc(rungs, compareRungs)
+	}
+	return rungs
+}
+
+// compareRungs orders rungs by height, H.264 first among rungs of a height.
+func compareRungs(a, b config.LadderRung) int {
+	if a.Height != b.Height {
+		return a.Height - b.Height
+	}
+	switch {
+	case isH264Rung(a) && !isH264Rung(b):
+		return -1
+	case isH264Rung(b) && !isH264Rung(a):
+		return 1
+	}
+	return 0
+}
+
+func isH264Rung(rung config.LadderRung) bool {
+	return rung.Codec == "h264"
+}
+
+// splitLadder separates the rung published first from the rest. It is the
+// lowest H.264 rung, which every client can play.
+func splitLadder(rungs []config.LadderRung) (first, rest []config.LadderRung) {
+	i := max(slices.IndexFunc(rungs, isH264Rung), 0)
+	rest = append(append([]config.LadderRung(nil), rungs[:i]...), rungs[i+1:]...)
+	return rungs[i : i+1], rest
+}
+
+// processLadder encodes the video rungs into outputDir/{rung name}. Audio is
+// encoded once into its own rendition, see processAudio.
+func (h *HLSBackgroundJob) processLadder(ctx context.Context, inputPath, outputDir string, rungs []config.LadderRung, frameRate float64, progress *progressTracker) error {
+	reporters := make([]func(encoded float64), len(rungs))
+	for i, rung := range rungs {
+		reporters[i] = progress.reporter(rung.Name)
+	}
+
+	return h.Transcoder.EncodeLadder(ctx, inputPath, LadderSpec{
+		OutputDir:       outputDir,
+		Rungs:           rungs,
+		SegmentType:     h.Cfg.Env.HLS_SEGMENT_TYPE,
+		SegmentDuration: hlsSegmentDuration,
+		GOPSize:         gopSize(frameRate),
+		Progress: func(encoded float64) {
+			for _, report := range reporters {
+				report(encoded)
+			}
+		},
+	})
+}
 
-	args := []string{
-		"-i", inputPath,
-		"-profile:v", "baseline",
-		"-level", "3.0",
-		"-start_number", "0",
-		"-hls_time", "10",
-		"-hls_list_size", "0",
-		"-f", "hls",
+// gopSize is the number of frames in hlsKeyframeInterval, sources with an
+// unknown frame rate are assumed to run at 30 fps.
+func gopSize(frameRate float64) int {
+	if frameRate <= 0 {
+		frameRate = 30
+	}
+	return max(int(math.Round(frameRate*hlsKeyframeInterval)), 1)
+}
+
+// encodeRenditions encodes a batch of rungs, describes what ffmpeg produced
+// and encrypts it when keys are given.
+func (h *HLSBackgroundJob) encodeRenditions(ctx context.Context, videoID, inputPath, outputDir string, rungs []config.LadderRung, frameRate float64, progress *progressTracker, keys [][]byte) ([]renditionInfo, error) {
+	if err := h.processLadder(ctx, inputPath, outputDir, rungs, frameRate, progress); err != nil {
+		return nil, fmt.Errorf("video conversion failed: %w", err)
+	}
+
+	renditions := make([]renditionInfo, 0, len(rungs))
+	for _, rung := range rungs {
+		// Describe the variant by what ffmpeg produced, not by the ladder config
+		rendition, err := h.inspectRendition(ctx, filepath.Join(outputDir, rung.Name), rung.Name)
+		if err != nil {
+			return nil, err
+		}
+		renditions = append(renditions, rendition)
 	}
 
-	if height > 0 {
-		args = append(args,
-			"-vf", fmt.Sprintf("scale=-2:%d", height),
-			"-b:v", bitrate,
-		)
+	// Bandwidth was measured on the clear segments, padding adds at most a block
+	if keys != nil {
+		if err := h.encryptRenditions(videoID, outputDir, renditions, keys); err != nil {
+			return nil, err
+		}
 	}
 
-	args = append(args,
-		"-hls_segment_filename", segmentPath,
-		playlistPath,
-	)
+	for _, rung := range rungs {
+		progress.complete(rung.Name)
+	}
+	return renditions, nil
+}
 
-	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
-	output, err := cmd.CombinedOutput()
+// publishMaster writes the master playlist of the renditions encoded so far.
+// With HLS enabled it uploads the new rendition directories, then the master
+// playlist, and makes the video playable with them.
+func (h *HLSBackgroundJob) publishMaster(ctx context.Context, videoID, outputDir string, renditions []renditionInfo, audio *renditionInfo, newDirs []string, states map[string]models.RenditionState, qualities []string) error {
+	// Captions uploaded while the video was processing
+	subtitles, err := h.SubtitleRepo.ListByVideo(videoID)
 	if err != nil {
-		return fmt.Errorf("FFmpeg failed: %v, output: %s", err, output)
+		return transientError("failed to list subtitles: %v", err)
+	}
+
+	masterPlaylist := h.buildMasterPlaylist(renditions, audio)
+	applySubtitles(masterPlaylist, subtitles)
+	if err := os.WriteFile(filepath.Join(outputDir, "master.m3u8"), masterPlaylist.Bytes(), 0644); err != nil {
+		return transientError("failed to write master playlist: %v", err)
+	}
+
+	// DASH only deployments publish once the manifest is packaged
+	if !h.Cfg.Env.OutputEnabled("hls") {
+		return nil
 	}
 
+	if err := h.uploadOutput(ctx, videoID, outputDir, append(newDirs, "master.m3u8")...); err != nil {
+		return transientError("upload HLS segments failed: %v", err)
+	}
+
+	hlsURL := videoPrefix(videoID) + "master.m3u8"
+	if err := h.Repo.PublishRenditions(videoID, states, append(append([]string(nil), qualities...), "original"), hlsURL); err != nil {
+		return transientError("failed to publish renditions: %v", err)
+	}
 	return nil
 }
 
+// HandleJobResult records the outcome of a job on the video. A failed job
+// only records its error, renditions it already published stay playable.
 func (h *HLSBackgroundJob) HandleJobResult(result HLSJobResult) error {
-	var (
-		processingError string
-		qualities       = []string{"original"} // Default qualities
-		hlsURL          string
-	)
-
-	// Capture error message if any
-	if result.Error != nil {
-		processingError = result.Error.Error()
+	if !result.Success {
+		return h.Repo.UpdateVideoProcessingStatus(result.VideoID, false, jobErrorMessage(result.Error), nil, "", "")
 	}
 
-	// Handle success case
-	if result.Success {
-		qualities = []string{"480p", "720p", "original"} // Update qualities
-		// Generate HLS URL
-		hlsURL = h.Cfg.Env.CDN_URL + "videos/" + result.VideoID + "/master.m3u8"
+	qualities := append(result.Qualities, "original")
+	// Store object keys, playback URLs are resolved when the video is served
+	var hlsURL, dashURL string
+	if h.Cfg.Env.OutputEnabled("hls") {
+		hlsURL = "videos/" + result.VideoID + "/master.m3u8"
+	}
+	if h.Cfg.Env.OutputEnabled("dash") {
+		dashURL = "videos/" + result.VideoID + "/dash/manifest.mpd"
 	}
 
-	// Update video processing status
-	return h.Repo.UpdateVideoProcessingStatus(result.VideoID, result.Success, processingError, qualities, hlsURL)
+	return h.Repo.UpdateVideoProcessingStatus(result.VideoID, true, "", qualities, hlsURL, dashURL)
+}
+
+func jobErrorMessage(err error) string {
+	if err == nil {
+		return "transcode failed without an error"
+	}
+	return err.Error()
 }
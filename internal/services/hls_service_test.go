@@ -0,0 +1,478 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"video-feed/config"
+	"video-feed/internal/models"
+	"video-feed/pkg/m3u8"
+	"video-feed/pkg/storage"
+)
+
+const testVideoID = "video1"
+
+// memoryVideoStore keeps videos in memory the way VideoRepository keeps them
+// in Postgres.
+type memoryVideoStore struct {
+	mu     sync.Mutex
+	videos map[string]*models.Video
+	// published holds the qualities of every PublishRenditions call
+	published [][]string
+}
+
+func (s *memoryVideoStore) video(videoID string) *models.Video {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	video := *s.videos[videoID]
+	return &video
+}
+
+func (s *memoryVideoStore) update(videoID string, apply func(video *models.Video)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	video, ok := s.videos[videoID]
+	if !ok {
+		return errors.New("video not found")
+	}
+	apply(video)
+	return nil
+}
+
+func (s *memoryVideoStore) GetVideoByID(videoID string) (*models.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	video, ok := s.videos[videoID]
+	if !ok {
+		return nil, errors.New("video not found")
+	}
+	copied := *video
+	return &copied, nil
+}
+
+func (s *memoryVideoStore) UpdateMediaInfo(videoID string, info models.MediaInfo) error {
+	return s.update(videoID, func(video *models.Video) {
+		video.Duration, video.Width, video.Height = info.Duration, info.Width, info.Height
+	})
+}
+
+func (s *memoryVideoStore) UpdateThumbnailURL(videoID, thumbnailURL string) error {
+	return s.update(videoID, func(video *models.Video) { video.ThumbnailURL = thumbnailURL })
+}
+
+func (s *memoryVideoStore) UpdateSpriteVTTURL(videoID, spriteVTTURL string) error {
+	return s.update(videoID, func(video *models.Video) { video.SpriteVTTURL = spriteVTTURL })
+}
+
+func (s *memoryVideoStore) UpdateRenditions(videoID string, renditions map[string]models.RenditionState) error {
+	return s.update(videoID, func(video *models.Video) { video.Renditions = maps.Clone(renditions) })
+}
+
+func (s *memoryVideoStore) PublishRenditions(videoID string, renditions map[string]models.RenditionState, qualities []string, hlsURL string) error {
+	return s.update(videoID, func(video *models.Video) {
+		video.Playable = true
+		video.Renditions = maps.Clone(renditions)
+		video.Qualities = qualities
+		video.HLSURL = hlsURL
+		s.published = append(s.published, qualities)
+	})
+}
+
+func (s *memoryVideoStore) UpdateVideoProcessingStatus(videoID string, processed bool, processingError string, qualities []string, hlsURL string, dashURL string) error {
+	return s.update(videoID, func(video *models.Video) {
+		video.HLSProcessed, video.ProcessingError = processed, processingError
+		if processed {
+			video.Playable = true
+			video.Qualities, video.HLSURL, video.DASHURL = qualities, hlsURL, dashURL
+		}
+	})
+}
+
+func (s *memoryVideoStore) MarkCancelled(videoID string) error {
+	return s.update(videoID, func(video *models.Video) {
+		video.HLSProcessed, video.ProcessingError = false, ""
+		video.Qualities = []string{"original"}
+		video.HLSURL, video.DASHURL, video.ThumbnailURL, video.SpriteVTTURL = "", "", "", ""
+		video.Playable, video.Renditions = false, map[string]models.RenditionState{}
+	})
+}
+
+type noSubtitles struct{}
+
+func (noSubtitles) ListByVideo(videoID string) ([]models.Subtitle, error) {
+	return nil, nil
+}
+
+type memoryKeyStore struct {
+	keys [][]byte
+}
+
+func (s *memoryKeyStore) List(videoID string) ([][]byte, error) {
+	return slices.Clone(s.keys), nil
+}
+
+func (s *memoryKeyStore) Append(videoID string, keys [][]byte) error {
+	s.keys = append(s.keys, keys...)
+	return nil
+}
+
+type memoryJobStore struct {
+	mu     sync.Mutex
+	ladder models.LadderChoice
+}
+
+func (s *memoryJobStore) UpdateProgress(videoID string, progress map[string]models.RenditionProgress) error {
+	return nil
+}
+
+func (s *memoryJobStore) UpdateLadder(videoID string, ladder models.LadderChoice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ladder = ladder
+	return nil
+}
+
+// failingLadder fails every EncodeLadder call after the first, the first
+// rendition gets published before the job fails.
+type failingLadder struct {
+	*FakeTranscoder
+	calls int
+}
+
+func (t *failingLadder) EncodeLadder(ctx context.Context, inputPath string, spec LadderSpec) error {
+	t.calls++
+	if t.calls > 1 {
+		return transientError("encoder crashed")
+	}
+	return t.FakeTranscoder.EncodeLadder(ctx, inputPath, spec)
+}
+
+type pipelineTest struct {
+	job     *HLSBackgroundJob
+	videos  *memoryVideoStore
+	keys    *memoryKeyStore
+	jobs    *memoryJobStore
+	storage *storage.LocalService
+}
+
+// newPipelineTest runs the pipeline from a temporary working directory, it
+// keeps its scratch files under tmp/, and stores output with the local backend.
+func newPipelineTest(t *testing.T, env config.Env, transcoder Transcoder) *pipelineTest {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	local, err := storage.NewLocalService("bucket", "http://cdn.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := videoPrefix(testVideoID) + "original.mp4"
+	if err := local.UploadObject(original, strings.NewReader("source"), 6, storage.UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if env.OUTPUT_FORMATS == nil {
+		env.OUTPUT_FORMATS = []string{"hls"}
+	}
+	if env.HLS_SEGMENT_TYPE == "" {
+		env.HLS_SEGMENT_TYPE = "mpegts"
+	}
+	if env.HLS_ENCRYPTION == "" {
+		env.HLS_ENCRYPTION = "none"
+	}
+	env.APP_URL = "http://app.test"
+	env.THUMBNAIL_OFFSET = 3 * time.Second
+	env.SPRITE_INTERVAL = 5 * time.Second
+	env.UPLOAD_CONCURRENCY = 4
+	env.UPLOAD_MAX_ATTEMPTS = 1
+	cfg := &config.AppConfig{Env: &env, Ladder: config.DefaultLadder}
+
+	videos := &memoryVideoStore{videos: map[string]*models.Video{
+		testVideoID: {ID: testVideoID, OriginalURL: original, Qualities: []string{"original"}},
+	}}
+	keys := &memoryKeyStore{}
+	jobs := &memoryJobStore{}
+	job := NewHLSBackgroundJob(cfg, local, videos, noSubtitles{}, keys, jobs, transcoder)
+	return &pipelineTest{job: job, videos: videos, keys: keys, jobs: jobs, storage: local}
+}
+
+func testMediaInfo() models.MediaInfo {
+	return models.MediaInfo{
+		Duration:   25,
+		Width:      1920,
+		Height:     1080,
+		FrameRate:  25,
+		VideoCodec: "h264",
+		AudioCodec: "aac",
+		Format:     "mov,mp4,m4a,3gp,3g2,mj2",
+	}
+}
+
+// run processes the test video and records the result like a worker does
+// after a successful attempt or a failed one that will not be retried.
+func (p *pipelineTest) run(t *testing.T) HLSJobResult {
+	t.Helper()
+	result := <-p.job.ProcessHLSWithTimeout(testVideoID, "input.mp4")
+	if err := p.job.HandleJobResult(result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func (p *pipelineTest) objectKeys(t *testing.T) []string {
+	t.Helper()
+	objects, err := p.storage.ListObjects(videoPrefix(testVideoID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0, len(objects))
+	for _, object := range objects {
+		keys = append(keys, strings.TrimPrefix(object.Key, videoPrefix(testVideoID)))
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (p *pipelineTest) master(t *testing.T) *m3u8.MasterPlaylist {
+	t.Helper()
+	reader, err := p.storage.GetObject(videoPrefix(testVideoID) + "master.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	master, err := m3u8.ParseMasterPlaylist(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return master
+}
+
+func assertKeys(t *testing.T, keys []string, want ...string) {
+	t.Helper()
+	for _, key := range want {
+		if !slices.Contains(keys, key) {
+			t.Errorf("%s was not uploaded, got %v", key, keys)
+		}
+	}
+}
+
+func TestProcessHLS(t *testing.T) {
+	p := newPipelineTest(t, config.Env{}, NewFakeTranscoder(testMediaInfo()))
+
+	result := p.run(t)
+	if !result.Success {
+		t.Fatalf("pipeline failed: %v", result.Error)
+	}
+	if want := []string{"480p", "720p"}; !slices.Equal(result.Qualities, want) {
+		t.Errorf("Qualities = %v, want %v", result.Qualities, want)
+	}
+
+	keys := p.objectKeys(t)
+	assertKeys(t, keys,
+		"original.mp4",
+		"master.m3u8",
+		"audio/playlist.m3u8", "audio/segment000.ts", "audio/segment002.ts",
+		"480p/playlist.m3u8", "480p/segment000.ts", "480p/segment001.ts", "480p/segment002.ts",
+		"720p/playlist.m3u8", "720p/segment002.ts",
+		"thumbs/poster_1280.jpg", "thumbs/poster_1280.webp", "thumbs/poster_320.jpg",
+		"sprites/sprite_001.jpg", "thumbnails.vtt",
+	)
+	for _, key := range keys {
+		if strings.HasSuffix(key, ".mpd") || strings.HasSuffix(key, ".png") || strings.HasSuffix(key, ".m4s") {
+			t.Errorf("%s should not be uploaded", key)
+		}
+	}
+
+	// Video variants from the lowest up, then the audio-only variant
+	master := p.master(t)
+	if master.Version != 3 || !master.IndependentSegments {
+		t.Errorf("master version %d, independent segments %t", master.Version, master.IndependentSegments)
+	}
+	if len(master.Media) != 1 || master.Media[0].Type != "AUDIO" || master.Media[0].URI != "audio/playlist.m3u8" {
+		t.Errorf("audio group = %+v", master.Media)
+	}
+	var uris []string
+	for _, variant := range master.Variants {
+		uris = append(uris, variant.URI)
+	}
+	if want := []string{"480p/playlist.m3u8", "720p/playlist.m3u8", "audio/playlist.m3u8"}; !slices.Equal(uris, want) {
+		t.Fatalf("variants = %v, want %v", uris, want)
+	}
+	low := master.Variants[0]
+	if low.Width != 854 || low.Height != 480 || low.FrameRate != 25 || low.Audio != audioGroupID {
+		t.Errorf("480p variant = %+v", low)
+	}
+	if want := []string{"avc1.42E01F", "mp4a.40.2"}; !slices.Equal(low.Codecs, want) {
+		t.Errorf("480p codecs = %v, want %v", low.Codecs, want)
+	}
+	if low.AverageBandwidth <= 0 || low.Bandwidth < low.AverageBandwidth {
+		t.Errorf("480p bandwidth %d, average %d", low.Bandwidth, low.AverageBandwidth)
+	}
+
+	video := p.videos.video(testVideoID)
+	if !video.HLSProcessed || !video.Playable || video.ProcessingError != "" {
+		t.Errorf("video processed %t, playable %t, error %q", video.HLSProcessed, video.Playable, video.ProcessingError)
+	}
+	if video.HLSURL != "videos/video1/master.m3u8" || video.DASHURL != "" {
+		t.Errorf("video hls_url %q, dash_url %q", video.HLSURL, video.DASHURL)
+	}
+	if want := []string{"480p", "720p", "original"}; !slices.Equal(video.Qualities, want) {
+		t.Errorf("video qualities = %v, want %v", video.Qualities, want)
+	}
+	for _, name := range []string{"480p", "720p"} {
+		if video.Renditions[name] != models.RenditionReady {
+			t.Errorf("rendition %s is %q", name, video.Renditions[name])
+		}
+	}
+	if video.ThumbnailURL != "videos/video1/thumbs/poster_1280.jpg" || video.SpriteVTTURL != "videos/video1/thumbnails.vtt" {
+		t.Errorf("video thumbnail %q, sprites %q", video.ThumbnailURL, video.SpriteVTTURL)
+	}
+
+	// The lowest rung is published on its own before the rest
+	want := [][]string{{"480p", "original"}, {"480p", "720p", "original"}}
+	if !slices.EqualFunc(p.videos.published, want, slices.Equal[[]string]) {
+		t.Errorf("published %v, want %v", p.videos.published, want)
+	}
+
+	if _, err := os.Stat(filepath.Join("tmp", "videos", testVideoID)); !os.IsNotExist(err) {
+		t.Errorf("output directory was not removed: %v", err)
+	}
+}
+
+func TestProcessHLSFragmentedWithDASH(t *testing.T) {
+	env := config.Env{OUTPUT_FORMATS: []string{"hls", "dash"}, HLS_SEGMENT_TYPE: "fmp4"}
+	p := newPipelineTest(t, env, NewFakeTranscoder(testMediaInfo()))
+
+	if result := p.run(t); !result.Success {
+		t.Fatalf("pipeline failed: %v", result.Error)
+	}
+
+	assertKeys(t, p.objectKeys(t),
+		"master.m3u8", "dash/manifest.mpd",
+		"480p/init.mp4", "480p/segment000.m4s", "720p/init.mp4", "audio/init.mp4",
+	)
+	if master := p.master(t); master.Version != 7 {
+		t.Errorf("master version = %d, want 7", master.Version)
+	}
+
+	video := p.videos.video(testVideoID)
+	if video.DASHURL != "videos/video1/dash/manifest.mpd" {
+		t.Errorf("video dash_url = %q", video.DASHURL)
+	}
+}
+
+func TestProcessHLSEncrypted(t *testing.T) {
+	p := newPipelineTest(t, config.Env{HLS_ENCRYPTION: "aes-128"}, NewFakeTranscoder(testMediaInfo()))
+
+	if result := p.run(t); !result.Success {
+		t.Fatalf("pipeline failed: %v", result.Error)
+	}
+	if len(p.keys.keys) != 1 {
+		t.Fatalf("stored %d keys, want 1", len(p.keys.keys))
+	}
+
+	reader, err := p.storage.GetObject(videoPrefix(testVideoID) + "480p/playlist.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	playlist, err := m3u8.ParseMediaPlaylist(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := playlist.Segments[0].Key
+	if key == nil || key.Method != "AES-128" || key.URI != "http://app.test/api/keys/video1?key=0" {
+		t.Errorf("first segment key = %+v", key)
+	}
+}
+
+func TestProcessHLSEncryptedRetryKeepsKeys(t *testing.T) {
+	p := newPipelineTest(t, config.Env{HLS_ENCRYPTION: "aes-128", HLS_KEY_ROTATION: 2}, NewFakeTranscoder(testMediaInfo()))
+
+	if result := p.run(t); !result.Success {
+		t.Fatalf("pipeline failed: %v", result.Error)
+	}
+	keys := slices.Clone(p.keys.keys)
+	if len(keys) < 2 {
+		t.Fatalf("stored %d keys, want rotation", len(keys))
+	}
+
+	// Published segments were encrypted with the keys of the first attempt
+	if result := p.run(t); !result.Success {
+		t.Fatalf("retry failed: %v", result.Error)
+	}
+	if !slices.EqualFunc(p.keys.keys, keys, bytes.Equal) {
+		t.Error("retry replaced the keys of the video")
+	}
+}
+
+func TestProcessHLSProbeFailure(t *testing.T) {
+	transcoder := NewFakeTranscoder(testMediaInfo())
+	transcoder.ProbeErr = permanentError("no video stream")
+	p := newPipelineTest(t, config.Env{}, transcoder)
+
+	result := p.run(t)
+	if result.Success || errorKind(result.Error) != models.JobErrorPermanent {
+		t.Fatalf("result = %+v, want a permanent error", result)
+	}
+	if keys := p.objectKeys(t); !slices.Equal(keys, []string{"original.mp4"}) {
+		t.Errorf("uploaded %v", keys)
+	}
+
+	video := p.videos.video(testVideoID)
+	if video.HLSProcessed || video.Playable || video.ProcessingError != "no video stream" {
+		t.Errorf("video processed %t, playable %t, error %q", video.HLSProcessed, video.Playable, video.ProcessingError)
+	}
+}
+
+func TestFailedJobKeepsPublishedRenditions(t *testing.T) {
+	p := newPipelineTest(t, config.Env{}, &failingLadder{FakeTranscoder: NewFakeTranscoder(testMediaInfo())})
+
+	result := p.run(t)
+	if result.Success {
+		t.Fatal("pipeline should fail on the second encode")
+	}
+
+	// The lowest rung stays playable after the failure
+	video := p.videos.video(testVideoID)
+	if video.HLSProcessed || !video.Playable || video.ProcessingError == "" {
+		t.Errorf("video processed %t, playable %t, error %q", video.HLSProcessed, video.Playable, video.ProcessingError)
+	}
+	if video.HLSURL != "videos/video1/master.m3u8" || video.Renditions["480p"] != models.RenditionReady {
+		t.Errorf("video hls_url %q, renditions %v", video.HLSURL, video.Renditions)
+	}
+	if master := p.master(t); len(master.Variants) != 2 || master.Variants[0].URI != "480p/playlist.m3u8" {
+		t.Errorf("master variants = %+v", master.Variants)
+	}
+
+	// Dead-lettering records the error the same way, the published output stays
+	result.Error = transientError("out of attempts")
+	if err := p.job.HandleJobResult(result); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"master.m3u8", "480p/playlist.m3u8", "thumbs/poster_1280.jpg", "thumbnails.vtt"} {
+		if !slices.Contains(p.objectKeys(t), key) {
+			t.Errorf("%s was removed from storage", key)
+		}
+	}
+	video = p.videos.video(testVideoID)
+	if !video.Playable || video.HLSURL == "" || video.ThumbnailURL == "" || video.ProcessingError != "out of attempts" {
+		t.Errorf("dead video = %+v", video)
+	}
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"video-feed/internal/repositories"
+)
+
+type KeyService struct {
+	repo      *repositories.VideoKeyRepository
+	videoRepo *repositories.VideoRepository
+}
+
+func NewKeyService(repo *repositories.VideoKeyRepository, videoRepo *repositories.VideoRepository) *KeyService {
+	return &KeyService{repo: repo, videoRepo: videoRepo}
+}
+
+// GetKey returns the AES-128 key of a rotation period of a video owned by
+// userID. Videos of other users look like they have no keys.
+func (ks *KeyService) GetKey(videoID, userID string, index int) ([]byte, error) {
+	video, err := ks.videoRepo.GetVideoByID(videoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if video.UserID != userID {
+		return nil, ErrKeyNotFound
+	}
+
+	key, err := ks.repo.Get(videoID, index)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
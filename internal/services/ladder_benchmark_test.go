@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"video-feed/config"
+)
+
+// BenchmarkLadder compares encoding the video rungs with one ffmpeg run per
+// rung against a single run for the whole ladder. LADDER_BENCH_INPUT picks the
+// source, a generated 1080p test pattern is used otherwise.
+//
+//	go test ./internal/services -run '^$' -bench Ladder -benchtime 3x
+func BenchmarkLadder(b *testing.B) {
+	for _, tool := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			b.Skipf("%s is not installed", tool)
+		}
+	}
+
+	ctx := context.Background()
+	inputPath := os.Getenv("LADDER_BENCH_INPUT")
+	if inputPath == "" {
+		inputPath = filepath.Join(b.TempDir(), "input.mp4")
+		generate := exec.Command("ffmpeg", "-v", "error",
+			"-f", "lavfi", "-i", "testsrc2=size=1920x1080:rate=30:duration=20",
+			"-f", "lavfi", "-i", "sine=frequency=440:duration=20",
+			"-c:v", "libx264", "-preset", "ultrafast", "-c:a", "aac", inputPath)
+		if out, err := generate.CombinedOutput(); err != nil {
+			b.Fatalf("failed to generate input: %v: %s", err, out)
+		}
+	}
+
+	transcoder := NewFFmpegTranscoder()
+	mediaInfo, err := transcoder.Probe(ctx, inputPath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	rungs := selectRungs(config.DefaultLadder, mediaInfo.DisplayHeight())
+	gop := gopSize(mediaInfo.FrameRate)
+
+	// The loop ProcessHLSWithTimeout used before the ladder was encoded at once
+	b.Run("per-rendition", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			workDir := b.TempDir()
+			for _, rung := range rungs {
+				rung := rung
+				dir := filepath.Join(workDir, rung.Name)
+				if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+					b.Fatal(err)
+				}
+				err := transcoder.EncodeRendition(ctx, inputPath, RenditionSpec{
+					OutputDir:       dir,
+					Video:           &rung,
+					SegmentType:     "mpegts",
+					SegmentDuration: hlsSegmentDuration,
+					GOPSize:         gop,
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("single-run", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := transcoder.EncodeLadder(ctx, inputPath, LadderSpec{
+				OutputDir:       b.TempDir(),
+				Rungs:           rungs,
+				SegmentType:     "mpegts",
+				SegmentDuration: hlsSegmentDuration,
+				GOPSize:         gop,
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
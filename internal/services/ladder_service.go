@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"video-feed/config"
+	"video-feed/internal/models"
+)
+
+const (
+	// Samples of the complexity analysis, spread evenly over the video
+	complexitySamples        = 3
+	complexitySampleDuration = 4.0
+	// Bounds of the per-title bitrate scale, the ladder stays recognizable
+	minLadderScale = 0.5
+	maxLadderScale = 1.5
+)
+
+// chooseLadder picks the bitrates of the rungs for this video and records
+// the choice on its job. With PER_TITLE_ENCODING a CRF probe encode of
+// sampled segments at the top H.264 rung's height measures what the content
+// needs, and every rung is scaled by how that compares to that rung's bitrate.
+// Talking heads get less than the configured ladder, high motion gets more.
+func (h *HLSBackgroundJob) chooseLadder(ctx context.Context, videoID, inputPath, workDir string, rungs []config.LadderRung, duration float64) []config.LadderRung {
+	choice := models.LadderChoice{Scale: 1, Rungs: rungs}
+
+	if h.Cfg.Env.PER_TITLE_ENCODING {
+		// The probe encode is x264, so it is compared to an H.264 rung
+		top := rungs[len(rungs)-1]
+		for _, rung := range rungs {
+			if isH264Rung(rung) {
+				top = rung
+			}
+		}
+		sampleBitrate, err := h.Transcoder.MeasureComplexity(ctx, inputPath, ComplexitySpec{
+			WorkDir:        workDir,
+			Height:         top.Height,
+			CRF:            h.Cfg.Env.PER_TITLE_CRF,
+			Samples:        complexitySampleStarts(duration),
+			SampleDuration: math.Min(complexitySampleDuration, duration),
+		})
+
+		// The analysis only tunes bitrates, the configured ladder still works
+		configured, _ := config.ParseBitrate(top.VideoBitrate)
+		if err != nil || sampleBitrate <= 0 || configured <= 0 {
+			log.Printf("Complexity analysis of video %s failed, using the configured ladder: %v", videoID, err)
+		} else {
+			scale := float64(sampleBitrate) / float64(configured)
+			scale = math.Round(math.Max(minLadderScale, math.Min(maxLadderScale, scale))*100) / 100
+
+			choice = models.LadderChoice{
+				PerTitle:      true,
+				SampleBitrate: sampleBitrate,
+				SampleHeight:  top.Height,
+				Scale:         scale,
+				Rungs:         scaleLadder(rungs, scale),
+			}
+		}
+	}
+
+	if err := h.JobRepo.UpdateLadder(videoID, choice); err != nil {
+		log.Printf("Failed to record the ladder of video %s: %v", videoID, err)
+	}
+	return choice.Rungs
+}
+
+// complexitySampleStarts spreads the samples evenly, a video shorter than all
+// samples together is measured as a whole.
+func complexitySampleStarts(duration float64) []float64 {
+	if duration <= complexitySamples*complexitySampleDuration {
+		return []float64{0}
+	}
+
+	starts := make([]float64, complexitySamples)
+	step := (duration - complexitySampleDuration) / (complexitySamples - 1)
+	for i := range starts {
+		starts[i] = math.Round(float64(i)*step*1000) / 1000
+	}
+	return starts
+}
+
+// scaleLadder multiplies the video bitrate, maxrate and bufsize of every
+// rung, the audio bitrate is left alone.
+func scaleLadder(rungs []config.LadderRung, scale float64) []config.LadderRung {
+	scaled := make([]config.LadderRung, len(rungs))
+	for i, rung := range rungs {
+		rung.VideoBitrate = scaleBitrate(rung.VideoBitrate, scale)
+		rung.MaxRate = scaleBitrate(rung.MaxRate, scale)
+		rung.BufSize = scaleBitrate(rung.BufSize, scale)
+		scaled[i] = rung
+	}
+	return scaled
+}
+
+func scaleBitrate(bitrate string, scale float64) string {
+	value, err := config.ParseBitrate(bitrate)
+	if err != nil {
+		return bitrate
+	}
+	return fmt.Sprintf("%dk", int(math.Round(float64(value)*scale/1000)))
+}
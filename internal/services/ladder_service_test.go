@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"video-feed/config"
+	"video-feed/internal/models"
+)
+
+func TestChooseLadder(t *testing.T) {
+	// The top H.264 rung of DefaultLadder is 720p at 2500k
+	tests := []struct {
+		name          string
+		perTitle      bool
+		sampleBitrate int
+		want          models.LadderChoice
+	}{
+		{
+			name:          "disabled",
+			sampleBitrate: 1250000,
+			want:          models.LadderChoice{Scale: 1, Rungs: config.DefaultLadder},
+		},
+		{
+			name:          "content needs the configured ladder",
+			perTitle:      true,
+			sampleBitrate: 2500000,
+			want:          models.LadderChoice{PerTitle: true, SampleBitrate: 2500000, SampleHeight: 720, Scale: 1, Rungs: config.DefaultLadder},
+		},
+		{
+			name:          "easy content",
+			perTitle:      true,
+			sampleBitrate: 1875000,
+			want: models.LadderChoice{PerTitle: true, SampleBitrate: 1875000, SampleHeight: 720, Scale: 0.75, Rungs: []config.LadderRung{
+				withBitrates(config.DefaultLadder[0], "750k", "825k", "1500k"),
+				withBitrates(config.DefaultLadder[1], "1875k", "2063k", "3750k"),
+			}},
+		},
+		{
+			name:          "clamped down",
+			perTitle:      true,
+			sampleBitrate: 300000,
+			want: models.LadderChoice{PerTitle: true, SampleBitrate: 300000, SampleHeight: 720, Scale: 0.5, Rungs: []config.LadderRung{
+				withBitrates(config.DefaultLadder[0], "500k", "550k", "1000k"),
+				withBitrates(config.DefaultLadder[1], "1250k", "1375k", "2500k"),
+			}},
+		},
+		{
+			name:          "clamped up",
+			perTitle:      true,
+			sampleBitrate: 20000000,
+			want: models.LadderChoice{PerTitle: true, SampleBitrate: 20000000, SampleHeight: 720, Scale: 1.5, Rungs: []config.LadderRung{
+				withBitrates(config.DefaultLadder[0], "1500k", "1650k", "3000k"),
+				withBitrates(config.DefaultLadder[1], "3750k", "4125k", "7500k"),
+			}},
+		},
+		{
+			name:          "failed analysis keeps the configured ladder",
+			perTitle:      true,
+			sampleBitrate: 0,
+			want:          models.LadderChoice{Scale: 1, Rungs: config.DefaultLadder},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transcoder := NewFakeTranscoder(testMediaInfo())
+			transcoder.SampleBitrate = test.sampleBitrate
+			p := newPipelineTest(t, config.Env{PER_TITLE_ENCODING: test.perTitle, PER_TITLE_CRF: 23}, transcoder)
+
+			rungs := p.job.chooseLadder(context.Background(), testVideoID, "input.mp4", t.TempDir(), config.DefaultLadder, 25)
+			if !reflect.DeepEqual(rungs, test.want.Rungs) {
+				t.Errorf("rungs = %+v, want %+v", rungs, test.want.Rungs)
+			}
+			if !reflect.DeepEqual(p.jobs.ladder, test.want) {
+				t.Errorf("saved ladder = %+v, want %+v", p.jobs.ladder, test.want)
+			}
+		})
+	}
+}
+
+func TestProcessHLSScalesLadderOfSmallSource(t *testing.T) {
+	// Smaller than every rung, the lowest H.264 rung is encoded at 360p
+	info := testMediaInfo()
+	info.Width, info.Height = 640, 360
+	transcoder := NewFakeTranscoder(info)
+	transcoder.SampleBitrate = 700000
+	p := newPipelineTest(t, config.Env{PER_TITLE_ENCODING: true, PER_TITLE_CRF: 23}, transcoder)
+
+	if result := p.run(t); !result.Success {
+		t.Fatalf("pipeline failed: %v", result.Error)
+	}
+
+	rung := config.DefaultLadder[0]
+	rung.Height = 360
+	want := models.LadderChoice{
+		PerTitle:      true,
+		SampleBitrate: 700000,
+		SampleHeight:  360,
+		Scale:         0.7,
+		Rungs:         []config.LadderRung{withBitrates(rung, "700k", "770k", "1400k")},
+	}
+	if !reflect.DeepEqual(p.jobs.ladder, want) {
+		t.Errorf("saved ladder = %+v, want %+v", p.jobs.ladder, want)
+	}
+	if master := p.master(t); master.Variants[0].Width != 640 || master.Variants[0].Height != 360 {
+		t.Errorf("master variants = %+v", master.Variants)
+	}
+}
+
+func TestScaleLadder(t *testing.T) {
+	rungs := []config.LadderRung{
+		{Name: "480p", VideoBitrate: "1000k", MaxRate: "1.1M", BufSize: "2000000", AudioBitrate: "96k"},
+		{Name: "odd", VideoBitrate: "333k", MaxRate: "not a bitrate", BufSize: "1M", AudioBitrate: "128k"},
+	}
+	want := []config.LadderRung{
+		{Name: "480p", VideoBitrate: "1370k", MaxRate: "1507k", BufSize: "2740k", AudioBitrate: "96k"},
+		{Name: "odd", VideoBitrate: "456k", MaxRate: "not a bitrate", BufSize: "1370k", AudioBitrate: "128k"},
+	}
+
+	if got := scaleLadder(rungs, 1.37); !reflect.DeepEqual(got, want) {
+		t.Errorf("scaleLadder = %+v, want %+v", got, want)
+	}
+	if rungs[0].VideoBitrate != "1000k" {
+		t.Error("scaleLadder changed the configured ladder")
+	}
+}
+
+func withBitrates(rung config.LadderRung, videoBitrate, maxRate, bufSize string) config.LadderRung {
+	rung.VideoBitrate, rung.MaxRate, rung.BufSize = videoBitrate, maxRate, bufSize
+	return rung
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"video-feed/internal/models"
+	"video-feed/pkg/utils/logger"
+)
+
+var (
+	uriAttribute = regexp.MustCompile(`URI="([^"]*)"`)
+	// SegmentList URL attributes of a DASH manifest
+	mpdURLAttribute = regexp.MustCompile(`(media|sourceURL)="([^"]*)"`)
+)
+
+// objectURL turns a stored object key into a URL the client can fetch.
+// Rows created before keys were stored already hold a full URL.
+func (vs *VideoService) objectURL(objectKey string) string {
+	if objectKey == "" || isAbsoluteURL(objectKey) {
+		return objectKey
+	}
+
+	if !vs.cfg.Env.SIGNED_URLS {
+		return vs.cfg.Env.CDN_URL + objectKey
+	}
+
+	signedURL, err := vs.storage.PresignGetObject(objectKey, vs.cfg.Env.SIGNED_URL_TTL)
+	if err != nil {
+		logger.Log.Error("failed to presign object ", objectKey, ": ", err)
+		return ""
+	}
+	return signedURL
+}
+
+// playlistURL returns the URL of a playlist, manifest or sprite track. With signed
+// URLs they are served by the API so the URIs inside can be signed on the fly.
+func (vs *VideoService) playlistURL(videoID, objectKey string) string {
+	if !vs.cfg.Env.SIGNED_URLS || objectKey == "" || isAbsoluteURL(objectKey) {
+		return vs.objectURL(objectKey)
+	}
+
+	name := strings.TrimPrefix(objectKey, videoPrefix(videoID))
+	return fmt.Sprintf("%s/api/videos/%s/hls/%s", vs.cfg.Env.APP_URL, videoID, name)
+}
+
+// presentVideo replaces stored object keys with playback URLs.
+func (vs *VideoService) presentVideo(video *models.Video) {
+	video.OriginalURL = vs.objectURL(video.OriginalURL)
+	video.HLSURL = vs.playlistURL(video.ID, video.HLSURL)
+	video.DASHURL = vs.playlistURL(video.ID, video.DASHURL)
+	video.ThumbnailURL = vs.objectURL(video.ThumbnailURL)
+	video.SpriteVTTURL = vs.playlistURL(video.ID, video.SpriteVTTURL)
+}
+
+// SignedPlaylist loads an HLS playlist, DASH manifest or sprite track of the
+// video from storage and rewrites every media URI to a presigned URL. Playlist
+// URIs stay relative so players keep resolving them through the API.
+func (vs *VideoService) SignedPlaylist(videoID, name string) ([]byte, error) {
+	prefix := videoPrefix(videoID)
+	playlistKey := path.Join(prefix, name)
+	ext := path.Ext(playlistKey)
+	if !strings.HasPrefix(playlistKey, prefix) || (ext != ".m3u8" && ext != ".mpd" && playlistKey != prefix+"thumbnails.vtt") {
+		return nil, fmt.Errorf("invalid playlist %s", name)
+	}
+
+	reader, err := vs.storage.GetObject(playlistKey)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	playlist, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read playlist %s: %w", playlistKey, err)
+	}
+
+	var out bytes.Buffer
+	var rewriteErr error
+	rewrite := func(uri string) string {
+		// Root relative URIs, like key URIs without APP_URL, are served by the API
+		if rewriteErr != nil || uri == "" || isAbsoluteURL(uri) || strings.HasPrefix(uri, "/") || path.Ext(stripQuery(uri)) == ".m3u8" {
+			return uri
+		}
+
+		objectKey := path.Join(path.Dir(playlistKey), uri)
+		if !strings.HasPrefix(objectKey, prefix) {
+			rewriteErr = fmt.Errorf("playlist %s references %s outside the video", playlistKey, uri)
+			return uri
+		}
+
+		signedURL, err := vs.storage.PresignGetObject(objectKey, vs.cfg.Env.SIGNED_URL_TTL)
+		if err != nil {
+			rewriteErr = err
+			return uri
+		}
+		return signedURL
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case ext == ".mpd":
+			line = mpdURLAttribute.ReplaceAllStringFunc(line, func(attr string) string {
+				match := mpdURLAttribute.FindStringSubmatch(attr)
+				return match[1] + `="` + html.EscapeString(rewrite(html.UnescapeString(match[2]))) + `"`
+			})
+		case ext == ".vtt":
+			// Cue payloads look like sprites/sprite_001.jpg#xywh=0,0,160,90
+			if uri, fragment, found := strings.Cut(line, "#xywh="); found {
+				line = rewrite(uri) + "#xywh=" + fragment
+			}
+		case strings.HasPrefix(line, "#"):
+			line = uriAttribute.ReplaceAllStringFunc(line, func(attr string) string {
+				return `URI="` + rewrite(uriAttribute.FindStringSubmatch(attr)[1]) + `"`
+			})
+		case line != "":
+			line = rewrite(line)
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse playlist %s: %w", playlistKey, err)
+	}
+	if rewriteErr != nil {
+		return nil, rewriteErr
+	}
+
+	return out.Bytes(), nil
+}
+
+func videoPrefix(videoID string) string {
+	return "videos/" + videoID + "/"
+}
+
+func isAbsoluteURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+func stripQuery(uri string) string {
+	if i := strings.IndexByte(uri, '?'); i >= 0 {
+		return uri[:i]
+	}
+	return uri
+}
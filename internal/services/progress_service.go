@@ -0,0 +1,89 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+	"video-feed/internal/models"
+)
+
+// Progress is written at most this often, ffmpeg reports several times a second
+const progressFlushInterval = time.Second
+
+// progressTracker keeps percent complete and ETA of every rendition of a
+// video and saves them on its running job.
+type progressTracker struct {
+	jobs     JobStore
+	videoID  string
+	duration float64
+
+	mu        sync.Mutex
+	progress  map[string]models.RenditionProgress
+	lastFlush time.Time
+}
+
+// newProgressTracker starts every planned rendition at 0% so the overall
+// percent does not jump when later renditions start.
+func newProgressTracker(jobs JobStore, videoID string, duration float64, renditions []string) *progressTracker {
+	t := &progressTracker{
+		jobs:     jobs,
+		videoID:  videoID,
+		duration: duration,
+		progress: map[string]models.RenditionProgress{},
+	}
+	for _, name := range renditions {
+		t.progress[name] = models.RenditionProgress{UpdatedAt: time.Now()}
+	}
+	t.flush()
+	return t
+}
+
+// reporter returns the Progress callback of a rendition, its ETA assumes the
+// rest encodes as fast as what was encoded since the call.
+func (t *progressTracker) reporter(name string) func(encoded float64) {
+	started := time.Now()
+	return func(encoded float64) {
+		if t.duration <= 0 {
+			return
+		}
+		percent := min(encoded/t.duration*100, 100)
+
+		var eta float64
+		if percent > 0 {
+			elapsed := time.Since(started).Seconds()
+			eta = elapsed * (100 - percent) / percent
+		}
+		t.set(name, percent, eta)
+	}
+}
+
+// complete marks a rendition as done, also when it was skipped.
+func (t *progressTracker) complete(name string) {
+	t.set(name, 100, 0)
+}
+
+func (t *progressTracker) set(name string, percent, eta float64) {
+	t.mu.Lock()
+	t.progress[name] = models.RenditionProgress{Percent: percent, ETASeconds: eta, UpdatedAt: time.Now()}
+	due := percent >= 100 || time.Since(t.lastFlush) >= progressFlushInterval
+	t.mu.Unlock()
+
+	if due {
+		t.flush()
+	}
+}
+
+func (t *progressTracker) flush() {
+	t.mu.Lock()
+	progress := make(map[string]models.RenditionProgress, len(t.progress))
+	for name, rendition := range t.progress {
+		progress[name] = rendition
+	}
+	t.lastFlush = time.Now()
+	t.mu.Unlock()
+
+	// Progress is informational, a failed write must not fail the job
+	if err := t.jobs.UpdateProgress(t.videoID, progress); err != nil {
+		log.Printf("Failed to store progress of video %s: %v", t.videoID, err)
+	}
+}
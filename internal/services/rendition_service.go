@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"video-feed/pkg/m3u8"
+)
+
+// renditionInfo describes an encoded rendition as ffmpeg actually wrote it.
+type renditionInfo struct {
+	Name      string
+	Playlist  *m3u8.MediaPlaylist
+	Width     int
+	Height    int
+	FrameRate float64
+	// Codecs holds RFC 6381 codec strings, video first
+	Codecs []string
+	// PeakBandwidth and AverageBandwidth are measured over the segments in bits/s
+	PeakBandwidth    int64
+	AverageBandwidth int64
+}
+
+// inspectRendition parses the media playlist in dir, measures the bandwidth of
+// its segments and probes the streams they carry.
+func (h *HLSBackgroundJob) inspectRendition(ctx context.Context, dir, name string) (renditionInfo, error) {
+	info := renditionInfo{Name: name}
+	playlistPath := filepath.Join(dir, "playlist.m3u8")
+
+	file, err := os.Open(playlistPath)
+	if err != nil {
+		return info, transientError("failed to open %s playlist: %v", name, err)
+	}
+	defer file.Close()
+
+	info.Playlist, err = m3u8.ParseMediaPlaylist(file)
+	if err != nil {
+		return info, permanentError("ffmpeg wrote an invalid %s playlist: %v", name, err)
+	}
+
+	var totalBits int64
+	for _, segment := range info.Playlist.Segments {
+		stat, err := os.Stat(filepath.Join(dir, segment.URI))
+		if err != nil {
+			return info, transientError("failed to stat %s segment: %v", name, err)
+		}
+
+		bits := stat.Size() * 8
+		totalBits += bits
+		if segment.Duration > 0 {
+			info.PeakBandwidth = max(info.PeakBandwidth, int64(float64(bits)/segment.Duration))
+		}
+	}
+	if duration := info.Playlist.Duration(); duration > 0 {
+		info.AverageBandwidth = int64(float64(totalBits) / duration)
+	}
+
+	streams, err := h.Transcoder.ProbeStreams(ctx, playlistPath)
+	if err != nil {
+		return info, err
+	}
+	for _, stream := range streams {
+		switch stream.CodecType {
+		case "video":
+			info.Width = stream.Width
+			info.Height = stream.Height
+			info.FrameRate = stream.FrameRate
+			info.Codecs = append([]string{codecString(stream)}, info.Codecs...)
+		case "audio":
+			info.Codecs = append(info.Codecs, codecString(stream))
+		}
+	}
+	return info, nil
+}
+
+// H.264 profile_idc and constraint flags by ffprobe profile name
+var avcProfiles = map[string]string{
+	"Constrained Baseline":  "42E0",
+	"Baseline":              "4200",
+	"Main":                  "4D40",
+	"Extended":              "5800",
+	"High":                  "6400",
+	"High 10":               "6E00",
+	"High 4:2:2":            "7A00",
+	"High 4:4:4 Predictive": "F400",
+}
+
+// HEVC profile space, profile_idc and compatibility flags by ffprobe profile name
+var hevcProfiles = map[string]string{
+	"Main":    "1.6",
+	"Main 10": "2.4",
+}
+
+// AAC audio object types by ffprobe profile name
+var aacProfiles = map[string]string{
+	"LC":       "2",
+	"HE-AAC":   "5",
+	"HE-AACv2": "29",
+}
+
+// codecString builds the RFC 6381 codec string of a stream.
+func codecString(stream StreamInfo) string {
+	switch stream.CodecName {
+	case "h264":
+		profile, ok := avcProfiles[stream.Profile]
+		if !ok {
+			profile = avcProfiles["High"]
+		}
+		return fmt.Sprintf("avc1.%s%02X", profile, stream.Level)
+	case "hevc":
+		// Main tier, and the progressive source constraint flag x265 sets
+		profile, ok := hevcProfiles[stream.Profile]
+		if !ok {
+			profile = hevcProfiles["Main"]
+		}
+		return fmt.Sprintf("hvc1.%s.L%d.B0", profile, stream.Level)
+	case "av1":
+		// Main profile and tier, ffprobe reports seq_level_idx as the level
+		return fmt.Sprintf("av01.0.%02dM.%02d", stream.Level, max(stream.BitDepth, 8))
+	case "aac":
+		objectType, ok := aacProfiles[stream.Profile]
+		if !ok {
+			objectType = aacProfiles["LC"]
+		}
+		return "mp4a.40." + objectType
+	case "mp3":
+		return "mp4a.40.34"
+	case "ac3":
+		return "ac-3"
+	case "eac3":
+		return "ec-3"
+	}
+	return strings.ToLower(stream.CodecName)
+}
@@ -0,0 +1,35 @@
+package services
+
+import "testing"
+
+func TestCodecString(t *testing.T) {
+	// One case per profile a ladder rung can pick, with the stream ffprobe
+	// reports for it
+	tests := []struct {
+		name   string
+		stream StreamInfo
+		want   string
+	}{
+		{"h264 baseline", StreamInfo{CodecName: "h264", Profile: "Constrained Baseline", Level: 31}, "avc1.42E01F"},
+		{"h264 main", StreamInfo{CodecName: "h264", Profile: "Main", Level: 31}, "avc1.4D401F"},
+		{"h264 high", StreamInfo{CodecName: "h264", Profile: "High", Level: 40}, "avc1.640028"},
+		{"h264 unknown profile", StreamInfo{CodecName: "h264", Profile: "Progressive High", Level: 42}, "avc1.64002A"},
+		{"h265 main", StreamInfo{CodecName: "hevc", Profile: "Main", Level: 93}, "hvc1.1.6.L93.B0"},
+		{"h265 main10", StreamInfo{CodecName: "hevc", Profile: "Main 10", Level: 120, BitDepth: 10}, "hvc1.2.4.L120.B0"},
+		{"av1 main", StreamInfo{CodecName: "av1", Profile: "Main", Level: 8}, "av01.0.08M.08"},
+		{"av1 main 10 bit", StreamInfo{CodecName: "av1", Profile: "Main", Level: 12, BitDepth: 10}, "av01.0.12M.10"},
+		{"aac lc", StreamInfo{CodecName: "aac", Profile: "LC"}, "mp4a.40.2"},
+		{"he-aac", StreamInfo{CodecName: "aac", Profile: "HE-AAC"}, "mp4a.40.5"},
+		{"mp3", StreamInfo{CodecName: "mp3"}, "mp4a.40.34"},
+		{"ac3", StreamInfo{CodecName: "ac3"}, "ac-3"},
+		{"unknown codec", StreamInfo{CodecName: "VP9"}, "vp9"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := codecString(test.stream); got != test.want {
+				t.Errorf("codecString = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"video-feed/internal/models"
+	"video-feed/pkg/storage"
+)
+
+const (
+	spriteTileWidth = 160
+	spriteColumns   = 10
+	spriteRows      = 10
+)
+
+// generateSprites samples a frame every SPRITE_INTERVAL, tiles the frames into
+// JPEG sprite sheets and writes a WebVTT track mapping each time range to its
+// #xywh region. Both are uploaded next to master.m3u8, the object key of the
+// track is returned.
+func (h *HLSBackgroundJob) generateSprites(ctx context.Context, videoID, inputPath, outputDir string, info models.MediaInfo) (string, error) {
+	interval := h.Cfg.Env.SPRITE_INTERVAL.Seconds()
+	if interval <= 0 {
+		return "", permanentError("invalid sprite interval %s", h.Cfg.Env.SPRITE_INTERVAL)
+	}
+
+	spritesDir := filepath.Join(outputDir, "sprites")
+	if err := os.MkdirAll(spritesDir, os.ModePerm); err != nil {
+		return "", transientError("failed to create sprite directory: %v", err)
+	}
+
+	tileHeight := int(math.Round(float64(spriteTileWidth*info.DisplayHeight())/float64(info.DisplayWidth())/2)) * 2
+	err := h.Transcoder.ExtractFrames(ctx, inputPath, FrameSpec{
+		Filter:     fmt.Sprintf("fps=1/%g,scale=%d:%d,tile=%dx%d", interval, spriteTileWidth, tileHeight, spriteColumns, spriteRows),
+		Quality:    5,
+		OutputPath: filepath.Join(spritesDir, "sprite_%03d.jpg"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("sprite extraction failed: %w", err)
+	}
+
+	sheets, err := filepath.Glob(filepath.Join(spritesDir, "sprite_*.jpg"))
+	if err != nil || len(sheets) == 0 {
+		return "", permanentError("ffmpeg produced no sprite sheets")
+	}
+
+	// The image2 muxer numbers files from 1
+	frames := int(math.Ceil(info.Duration / interval))
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n")
+	for frame := 0; frame < frames && frame/(spriteColumns*spriteRows) < len(sheets); frame++ {
+		sheet := frame/(spriteColumns*spriteRows) + 1
+		tile := frame % (spriteColumns * spriteRows)
+		start := float64(frame) * interval
+		end := math.Min(start+interval, info.Duration)
+
+		fmt.Fprintf(&vtt, "\n%s --> %s\nsprites/sprite_%03d.jpg#xywh=%d,%d,%d,%d\n",
+			formatVTTTimestamp(start), formatVTTTimestamp(end), sheet,
+			(tile%spriteColumns)*spriteTileWidth, (tile/spriteColumns)*tileHeight, spriteTileWidth, tileHeight)
+	}
+
+	vttPath := filepath.Join(outputDir, "thumbnails.vtt")
+	if err := os.WriteFile(vttPath, []byte(vtt.String()), 0644); err != nil {
+		return "", transientError("failed to write sprite track: %v", err)
+	}
+
+	for _, sheet := range sheets {
+		objectKey := fmt.Sprintf("videos/%s/sprites/%s", videoID, filepath.Base(sheet))
+		if err := storage.UploadFile(h.Storage, objectKey, sheet); err != nil {
+			return "", transientError("failed to upload sprite sheet %s: %v", filepath.Base(sheet), err)
+		}
+	}
+
+	vttKey := fmt.Sprintf("videos/%s/thumbnails.vtt", videoID)
+	if err := storage.UploadFile(h.Storage, vttKey, vttPath); err != nil {
+		return "", transientError("failed to upload sprite track: %v", err)
+	}
+	return vttKey, nil
+}
+
+// formatVTTTimestamp formats seconds as hh:mm:ss.mmm
+func formatVTTTimestamp(seconds float64) string {
+	d := time.Duration(math.Round(seconds*1000)) * time.Millisecond
+	return fmt.Sprintf("%02d:%02d:%02d.%03d",
+		int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, d.Milliseconds()%1000)
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+	"video-feed/internal/dto"
+	"video-feed/internal/models"
+)
+
+// VideoStatus reports where the video is in the pipeline. Percent is the
+// mean of the planned renditions, the ETA extrapolates from the time the
+// current attempt has taken so far.
+func (vs *VideoService) VideoStatus(videoID string) (*dto.VideoStatusResponse, error) {
+	video, err := vs.repo.GetVideoByID(videoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrVideoNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status := &dto.VideoStatusResponse{
+		VideoID:         video.ID,
+		Status:          "uploaded",
+		HLSProcessed:    video.HLSProcessed,
+		Playable:        video.Playable,
+		ProcessingError: video.ProcessingError,
+		Renditions:      map[string]models.RenditionProgress{},
+	}
+	if video.HLSProcessed {
+		status.Status = "ready"
+		status.Percent = 100
+	} else if video.CancelledAt != nil {
+		status.Status = "cancelled"
+	}
+
+	job, err := vs.queue.LatestJob(videoID)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil || video.HLSProcessed {
+		return status, nil
+	}
+
+	status.Attempts = job.Attempts
+	switch job.State {
+	case models.JobQueued:
+		status.Status = "queued"
+	case models.JobRunning:
+		status.Status = "processing"
+		status.Renditions = job.Progress
+	case models.JobFailed, models.JobDead:
+		status.Status = "failed"
+	case models.JobCancelled:
+		status.Status = "cancelled"
+	}
+
+	if len(job.Progress) > 0 && job.State == models.JobRunning {
+		var total float64
+		for _, rendition := range job.Progress {
+			total += rendition.Percent
+		}
+		status.Percent = total / float64(len(job.Progress))
+
+		if job.StartedAt != nil && status.Percent > 0 {
+			elapsed := time.Since(*job.StartedAt).Seconds()
+			status.ETASeconds = elapsed * (100 - status.Percent) / status.Percent
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"video-feed/internal/models"
+	"video-feed/pkg/m3u8"
+	"video-feed/pkg/storage"
+	"video-feed/pkg/utils"
+)
+
+const (
+	subtitleGroupID = "subs"
+	maxSubtitleSize = 5 << 20
+)
+
+var (
+	ErrVideoNotFound    = errors.New("video not found")
+	ErrSubtitleNotFound = errors.New("subtitle not found")
+	ErrInvalidSubtitle  = errors.New("invalid subtitle")
+
+	// BCP 47 language tags like en, pt-BR or zh-Hant
+	languageTag = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+	// SRT writes milliseconds after a comma, WebVTT after a dot
+	srtTimestamp = regexp.MustCompile(`(\d{2}:\d{2}:\d{2}),(\d{3})`)
+)
+
+// UploadSubtitle stores an SRT or WebVTT track for the video, replacing the
+// track of the same language. Tracks of a processed video are published to its
+// master playlist right away, nothing is encoded again.
+func (vs *VideoService) UploadSubtitle(videoID, userID, language, label string, file *multipart.FileHeader) (*models.Subtitle, error) {
+	video, err := vs.ownedVideo(videoID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !languageTag.MatchString(language) {
+		return nil, fmt.Errorf("%w: language must be a BCP 47 tag like en or pt-BR", ErrInvalidSubtitle)
+	}
+	// Labels end up in a quoted playlist attribute
+	label = strings.Join(strings.FieldsFunc(label, func(r rune) bool { return r == '"' || r == '\n' || r == '\r' }), "")
+	if label == "" {
+		label = language
+	}
+
+	if file.Size > maxSubtitleSize {
+		return nil, fmt.Errorf("%w: file is larger than %d bytes", ErrInvalidSubtitle, maxSubtitleSize)
+	}
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open subtitle: %v", err)
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, maxSubtitleSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subtitle: %v", err)
+	}
+	vtt, err := toWebVTT(data, subtitleTimestampOffset(vs.cfg.Env.HLS_SEGMENT_TYPE))
+	if err != nil {
+		return nil, err
+	}
+
+	// Segment the track into a single segment subtitle playlist
+	duration := video.Duration
+	if duration <= 0 {
+		duration = lastCueEnd(vtt)
+	}
+	playlist := m3u8.MediaPlaylist{
+		Version:  3,
+		Segments: []m3u8.Segment{{URI: language + ".vtt", Duration: duration}},
+	}
+	playlistData := playlist.Bytes()
+
+	prefix := videoPrefix(videoID) + "subtitles/" + language
+	err = vs.storage.UploadObject(prefix+".vtt", bytes.NewReader(vtt), int64(len(vtt)), storage.UploadOptions{
+		ContentType: storage.ContentTypeFor(".vtt"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload subtitle: %v", err)
+	}
+	err = vs.storage.UploadObject(prefix+".m3u8", bytes.NewReader(playlistData), int64(len(playlistData)), storage.UploadOptions{
+		ContentType: storage.ContentTypeFor(".m3u8"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload subtitle playlist: %v", err)
+	}
+
+	subtitle := models.Subtitle{
+		ID:        utils.GenerateUniqueID(),
+		VideoID:   videoID,
+		Language:  language,
+		Label:     label,
+		VTTURL:    prefix + ".vtt",
+		CreatedAt: time.Now(),
+	}
+	if err := vs.subtitles.Upsert(&subtitle); err != nil {
+		return nil, fmt.Errorf("failed to save subtitle: %v", err)
+	}
+
+	if err := vs.publishSubtitles(video); err != nil {
+		return nil, err
+	}
+
+	subtitle.VTTURL = vs.objectURL(subtitle.VTTURL)
+	return &subtitle, nil
+}
+
+func (vs *VideoService) ListSubtitles(videoID string) ([]models.Subtitle, error) {
+	subtitles, err := vs.subtitles.ListByVideo(videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range subtitles {
+		subtitles[i].VTTURL = vs.objectURL(subtitles[i].VTTURL)
+	}
+	return subtitles, nil
+}
+
+// DeleteSubtitle removes a track and takes it out of the master playlist.
+func (vs *VideoService) DeleteSubtitle(videoID, userID, language string) error {
+	video, err := vs.ownedVideo(videoID, userID)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := vs.subtitles.Delete(videoID, language)
+	if err != nil {
+		return fmt.Errorf("failed to delete subtitle: %v", err)
+	}
+	if !deleted {
+		return ErrSubtitleNotFound
+	}
+
+	if err := vs.publishSubtitles(video); err != nil {
+		return err
+	}
+
+	// The playlist no longer references the objects
+	prefix := videoPrefix(videoID) + "subtitles/" + language
+	for _, objectName := range []string{prefix + ".m3u8", prefix + ".vtt"} {
+		if err := vs.storage.DeleteObject(objectName); err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			return fmt.Errorf("failed to delete %s: %v", objectName, err)
+		}
+	}
+	return nil
+}
+
+// publishSubtitles rewrites the master playlist of a video with its current
+// subtitle tracks once it has one, renditions may still be encoding. Videos
+// without a master playlist pick them up when their first one is written.
+func (vs *VideoService) publishSubtitles(video *models.Video) error {
+	if video.HLSURL == "" || isAbsoluteURL(video.HLSURL) {
+		return nil
+	}
+
+	subtitles, err := vs.subtitles.ListByVideo(video.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list subtitles: %v", err)
+	}
+
+	reader, err := vs.storage.GetObject(video.HLSURL)
+	if err != nil {
+		return fmt.Errorf("failed to read master playlist: %v", err)
+	}
+	playlist, err := m3u8.ParseMasterPlaylist(reader)
+	reader.Close()
+	if err != nil {
+		return fmt.Errorf("failed to parse master playlist: %v", err)
+	}
+
+	applySubtitles(playlist, subtitles)
+	data := playlist.Bytes()
+	err = vs.storage.UploadObject(video.HLSURL, bytes.NewReader(data), int64(len(data)), storage.UploadOptions{
+		ContentType: storage.ContentTypeFor(video.HLSURL),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload master playlist: %v", err)
+	}
+	return nil
+}
+
+func (vs *VideoService) ownedVideo(videoID, userID string) (*models.Video, error) {
+	video, err := vs.repo.GetVideoByID(videoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrVideoNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if video.UserID != userID {
+		return nil, ErrVideoNotFound
+	}
+	return video, nil
+}
+
+// applySubtitles replaces the subtitle renditions of the playlist and points
+// every variant at the subtitle group.
+func applySubtitles(playlist *m3u8.MasterPlaylist, subtitles []models.Subtitle) {
+	media := playlist.Media[:0]
+	for _, rendition := range playlist.Media {
+		if rendition.Type != "SUBTITLES" {
+			media = append(media, rendition)
+		}
+	}
+	for _, subtitle := range subtitles {
+		media = append(media, m3u8.Media{
+			Type:       "SUBTITLES",
+			GroupID:    subtitleGroupID,
+			Name:       subtitle.Label,
+			Language:   subtitle.Language,
+			AutoSelect: true,
+			URI:        "subtitles/" + subtitle.Language + ".m3u8",
+		})
+	}
+	playlist.Media = media
+
+	groupID := ""
+	if len(subtitles) > 0 {
+		groupID = subtitleGroupID
+	}
+	for i := range playlist.Variants {
+		playlist.Variants[i].Subtitles = groupID
+	}
+}
+
+// subtitleTimestampOffset returns the media timestamp, in 90kHz ticks, that
+// cue time 0 maps to. ffmpeg's mpegts muxer starts the segments at 1.4s,
+// fMP4 segments start at 0.
+func subtitleTimestampOffset(segmentType string) int64 {
+	if segmentType == "fmp4" {
+		return 0
+	}
+	return 126000
+}
+
+// toWebVTT validates a WebVTT track or converts an SRT one. Both get an
+// X-TIMESTAMP-MAP header so players line the cues up with the segments.
+func toWebVTT(data []byte, mpegts int64) ([]byte, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("%w: file must be UTF-8 encoded", ErrInvalidSubtitle)
+	}
+	if !bytes.Contains(data, []byte("-->")) {
+		return nil, fmt.Errorf("%w: file has no cues", ErrInvalidSubtitle)
+	}
+
+	timestampMap := fmt.Sprintf("X-TIMESTAMP-MAP=MPEGTS:%d,LOCAL:00:00:00.000", mpegts)
+	if bytes.HasPrefix(data, []byte("WEBVTT")) {
+		// The header ends at the first blank line, keep a map the file has
+		header, _, _ := bytes.Cut(data, []byte("\n\n"))
+		if bytes.Contains(header, []byte("X-TIMESTAMP-MAP=")) {
+			return data, nil
+		}
+		signature, rest, _ := bytes.Cut(data, []byte("\n"))
+		return slices.Concat(signature, []byte("\n"+timestampMap+"\n"), rest), nil
+	}
+
+	// SRT cue numbers are valid WebVTT cue identifiers, only timings differ
+	var out bytes.Buffer
+	out.WriteString("WEBVTT\n" + timestampMap + "\n\n")
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.Contains(line, "-->") {
+			line = srtTimestamp.ReplaceAllString(line, "$1.$2")
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSubtitle, err)
+	}
+	return out.Bytes(), nil
+}
+
+// lastCueEnd returns the end of the last cue in seconds.
+func lastCueEnd(vtt []byte) float64 {
+	var end float64
+	scanner := bufio.NewScanner(bytes.NewReader(vtt))
+	for scanner.Scan() {
+		_, timing, found := strings.Cut(scanner.Text(), "-->")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(timing)
+		if len(fields) > 0 {
+			end = math.Max(end, parseCueTimestamp(fields[0]))
+		}
+	}
+	return end
+}
+
+// parseCueTimestamp parses hh:mm:ss.ttt or mm:ss.ttt.
+func parseCueTimestamp(timestamp string) float64 {
+	var seconds float64
+	for _, part := range strings.Split(timestamp, ":") {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0
+		}
+		seconds = seconds*60 + value
+	}
+	return seconds
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestToWebVTT(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		mpegts int64
+		want   string
+	}{
+		{
+			name:   "srt",
+			input:  "1\n00:00:01,000 --> 00:00:02,500\nHello\n\n2\n00:01:02,040 --> 00:01:03,000\n<i>World</i>\n",
+			mpegts: 126000,
+			want:   "WEBVTT\nX-TIMESTAMP-MAP=MPEGTS:126000,LOCAL:00:00:00.000\n\n1\n00:00:01.000 --> 00:00:02.500\nHello\n\n2\n00:01:02.040 --> 00:01:03.000\n<i>World</i>\n",
+		},
+		{
+			name:   "srt with bom and crlf",
+			input:  "\xef\xbb\xbf1\r\n00:00:01,000 --> 00:00:02,000\r\nHello\r\n",
+			mpegts: 0,
+			want:   "WEBVTT\nX-TIMESTAMP-MAP=MPEGTS:0,LOCAL:00:00:00.000\n\n1\n00:00:01.000 --> 00:00:02.000\nHello\n",
+		},
+		{
+			name:   "webvtt gets a timestamp map",
+			input:  "WEBVTT - English\nKind: captions\n\n00:01.000 --> 00:02.000 align:start\nHello\n",
+			mpegts: 126000,
+			want:   "WEBVTT - English\nX-TIMESTAMP-MAP=MPEGTS:126000,LOCAL:00:00:00.000\nKind: captions\n\n00:01.000 --> 00:02.000 align:start\nHello\n",
+		},
+		{
+			name:   "webvtt keeps its timestamp map",
+			input:  "WEBVTT\nX-TIMESTAMP-MAP=LOCAL:00:00:00.000,MPEGTS:900000\n\n00:01.000 --> 00:02.000\nHello\n",
+			mpegts: 126000,
+			want:   "WEBVTT\nX-TIMESTAMP-MAP=LOCAL:00:00:00.000,MPEGTS:900000\n\n00:01.000 --> 00:02.000\nHello\n",
+		},
+		{
+			name:   "map in a cue is not the header's",
+			input:  "WEBVTT\n\n00:01.000 --> 00:02.000\nX-TIMESTAMP-MAP=MPEGTS:1\n",
+			mpegts: 0,
+			want:   "WEBVTT\nX-TIMESTAMP-MAP=MPEGTS:0,LOCAL:00:00:00.000\n\n00:01.000 --> 00:02.000\nX-TIMESTAMP-MAP=MPEGTS:1\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := toWebVTT([]byte(test.input), test.mpegts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestToWebVTTRejectsInvalidTracks(t *testing.T) {
+	for name, input := range map[string]string{
+		"not utf-8": "1\n00:00:01,000 --> 00:00:02,000\n\xff\xfe\n",
+		"no cues":   "WEBVTT\n\nNOTE nothing here\n",
+		"empty":     "",
+	} {
+		if _, err := toWebVTT([]byte(input), 0); !errors.Is(err, ErrInvalidSubtitle) {
+			t.Errorf("%s: error = %v, want ErrInvalidSubtitle", name, err)
+		}
+	}
+}
+
+func TestLastCueEnd(t *testing.T) {
+	vtt, err := toWebVTT([]byte("1\n00:00:01,000 --> 00:00:02,500\nHello\n\n2\n01:00:02,040 --> 01:00:03,000\nWorld\n"), 126000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end := lastCueEnd(vtt); end != 3603 {
+		t.Errorf("lastCueEnd = %g, want 3603", end)
+	}
+}
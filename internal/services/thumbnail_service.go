@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"video-feed/internal/models"
+	"video-feed/pkg/storage"
+)
+
+// Poster widths, the largest one that fits the source becomes thumbnail_url
+var thumbnailWidths = []int{1280, 640, 320}
+
+const (
+	// Seconds after the offset searched for the poster frame
+	thumbnailSceneWindow = 10.0
+	// Frames scoring at most this are too close to the frame before to matter
+	thumbnailSceneThreshold = 0.1
+)
+
+// generateThumbnails picks the frame with the best scene score in the window
+// after the configured offset as poster, renders it as JPEG and WebP in a few
+// sizes and uploads them under videos/{id}/thumbs/. It returns the object key
+// of the largest JPEG.
+func (h *HLSBackgroundJob) generateThumbnails(ctx context.Context, videoID, inputPath, outputDir string, info models.MediaInfo) (string, error) {
+	thumbsDir := filepath.Join(outputDir, "thumbs")
+	if err := os.MkdirAll(thumbsDir, os.ModePerm); err != nil {
+		return "", transientError("failed to create thumbnail directory: %v", err)
+	}
+
+	// Seek close to the offset, short videos start a third of the way in
+	offset := h.Cfg.Env.THUMBNAIL_OFFSET.Seconds()
+	if offset >= info.Duration {
+		offset = info.Duration / 3
+	}
+
+	posterTime, err := h.bestSceneTime(ctx, inputPath, offset, info.Duration)
+	if err != nil {
+		return "", err
+	}
+
+	posterPath := filepath.Join(thumbsDir, "poster.png")
+	err = h.Transcoder.ExtractFrames(ctx, inputPath, FrameSpec{
+		Seek:       posterTime,
+		MaxFrames:  1,
+		OutputPath: posterPath,
+	})
+	if err != nil {
+		return "", fmt.Errorf("poster extraction failed: %w", err)
+	}
+
+	var thumbnailKey string
+	for _, width := range thumbnailWidths {
+		// Never upscale, but always keep the smallest size
+		if width > info.DisplayWidth() && width != thumbnailWidths[len(thumbnailWidths)-1] {
+			continue
+		}
+
+		scale := fmt.Sprintf("scale='min(%d,iw)':-2", width)
+		jpegName := fmt.Sprintf("poster_%d.jpg", width)
+		webpName := fmt.Sprintf("poster_%d.webp", width)
+		outputs := []FrameSpec{
+			{Filter: scale, Quality: 3, OutputPath: filepath.Join(thumbsDir, jpegName)},
+			{Filter: scale, Quality: 80, OutputPath: filepath.Join(thumbsDir, webpName)},
+		}
+		for _, spec := range outputs {
+			if err := h.Transcoder.ExtractFrames(ctx, posterPath, spec); err != nil {
+				return "", fmt.Errorf("thumbnail %d resize failed: %w", width, err)
+			}
+		}
+
+		for _, name := range []string{jpegName, webpName} {
+			objectKey := fmt.Sprintf("videos/%s/thumbs/%s", videoID, name)
+			if err := storage.UploadFile(h.Storage, objectKey, filepath.Join(thumbsDir, name)); err != nil {
+				return "", transientError("failed to upload thumbnail %s: %v", name, err)
+			}
+		}
+
+		if thumbnailKey == "" {
+			thumbnailKey = fmt.Sprintf("videos/%s/thumbs/%s", videoID, jpegName)
+		}
+	}
+
+	return thumbnailKey, nil
+}
+
+// bestSceneTime returns the time of the frame with the highest scene score in
+// the window after offset. A window without scene changes, like a static
+// shot, keeps the frame at offset.
+func (h *HLSBackgroundJob) bestSceneTime(ctx context.Context, inputPath string, offset, duration float64) (float64, error) {
+	scores, err := h.Transcoder.SceneScores(ctx, inputPath, SceneSpec{
+		Seek:      offset,
+		Duration:  math.Min(thumbnailSceneWindow, duration-offset),
+		Threshold: thumbnailSceneThreshold,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("scene scoring failed: %w", err)
+	}
+
+	best := SceneScore{Time: offset}
+	for _, score := range scores {
+		if score.Score > best.Score {
+			best = score
+		}
+	}
+	return best.Time, nil
+}
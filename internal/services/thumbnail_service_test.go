@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"video-feed/config"
+)
+
+func TestGenerateThumbnailsPicksBestScene(t *testing.T) {
+	tests := []struct {
+		name   string
+		scenes []SceneScore
+		want   string
+	}{
+		{
+			name: "highest score in the window",
+			scenes: []SceneScore{
+				// Before the 3s offset and after the 10s window
+				{Time: 1, Score: 0.9},
+				{Time: 4.2, Score: 0.3},
+				{Time: 7.5, Score: 0.6},
+				{Time: 9, Score: 0.05},
+				{Time: 14, Score: 0.95},
+			},
+			want: "fake frame at 7.500: ",
+		},
+		{
+			name:   "static shot keeps the offset",
+			scenes: []SceneScore{{Time: 5, Score: 0.02}},
+			want:   "fake frame at 3.000: ",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transcoder := NewFakeTranscoder(testMediaInfo())
+			transcoder.Scenes = test.scenes
+			p := newPipelineTest(t, config.Env{}, transcoder)
+
+			outputDir := t.TempDir()
+			key, err := p.job.generateThumbnails(context.Background(), testVideoID, "input.mp4", outputDir, testMediaInfo())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key != "videos/video1/thumbs/poster_1280.jpg" {
+				t.Errorf("thumbnail key = %q", key)
+			}
+
+			poster, err := os.ReadFile(filepath.Join(outputDir, "thumbs", "poster.png"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(poster) != test.want {
+				t.Errorf("poster = %q, want %q", poster, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"video-feed/internal/models"
+)
+
+// TranscodeError tags a pipeline failure with whether a retry may succeed.
+type TranscodeError struct {
+	Kind models.JobErrorKind
+	Err  error
+}
+
+func (e *TranscodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TranscodeError) Unwrap() error {
+	return e.Err
+}
+
+// transientError is for failures that may pass on retry, like storage or timeouts.
+func transientError(format string, args ...interface{}) error {
+	return &TranscodeError{Kind: models.JobErrorTransient, Err: fmt.Errorf(format, args...)}
+}
+
+// permanentError is for failures caused by the input itself.
+func permanentError(format string, args ...interface{}) error {
+	return &TranscodeError{Kind: models.JobErrorPermanent, Err: fmt.Errorf(format, args...)}
+}
+
+// errorKind classifies err, unknown errors are treated as transient.
+func errorKind(err error) models.JobErrorKind {
+	var transcodeErr *TranscodeError
+	if errors.As(err, &transcodeErr) {
+		return transcodeErr.Kind
+	}
+	return models.JobErrorTransient
+}
+
+// inputErrorPatterns is what ffmpeg prints when it cannot demux or decode the
+// input, retrying will not change that.
+var inputErrorPatterns = [][]byte{
+	[]byte("invalid data found when processing input"),
+	[]byte("moov atom not found"),
+	[]byte("could not find codec parameters"),
+	[]byte("error while decoding stream"),
+	[]byte("does not contain any stream"),
+}
+
+// ffmpegError classifies a failed ffmpeg run. Timeouts, processes killed by a
+// signal like the OOM killer and failures we do not recognise are transient,
+// only output that points at the input makes it permanent.
+func ffmpegError(ctx context.Context, action string, err error, output []byte) error {
+	if ctx.Err() != nil {
+		return transientError("FFmpeg timed out: %v", ctx.Err())
+	}
+	if killedBySignal(err) {
+		return transientError("%s, killed: %v", action, err)
+	}
+
+	lower := bytes.ToLower(output)
+	for _, pattern := range inputErrorPatterns {
+		if bytes.Contains(lower, pattern) {
+			return permanentError("%s: %v, output: %s", action, err, output)
+		}
+	}
+	return transientError("%s: %v, output: %s", action, err, output)
+}
+
+// killedBySignal reports whether err is the exit of a process that did not
+// exit on its own.
+func killedBySignal(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == -1
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"video-feed/internal/models"
+)
+
+func TestFFmpegErrorKind(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	// Exit errors of real processes, ffmpeg exits with 1 on any failure
+	exitErr := func(script string) error {
+		t.Helper()
+		err := exec.Command("sh", "-c", script).Run()
+		if err == nil {
+			t.Fatalf("%q did not fail", script)
+		}
+		return err
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		err    error
+		output string
+		want   models.JobErrorKind
+	}{
+		{"not a media file", context.Background(), exitErr("exit 1"), "input.mp4: Invalid data found when processing input", models.JobErrorPermanent},
+		{"truncated mp4", context.Background(), exitErr("exit 1"), "[mov,mp4,m4a,3gp,3g2,mj2 @ 0x1] moov atom not found", models.JobErrorPermanent},
+		{"decode failure", context.Background(), exitErr("exit 1"), "Error while decoding stream #0:0: Invalid data found when processing input", models.JobErrorPermanent},
+		{"killed by the OOM killer", context.Background(), exitErr("kill -KILL $$"), "frame= 1200 fps=30", models.JobErrorTransient},
+		{"killed mid-decode", context.Background(), exitErr("kill -TERM $$"), "Error while decoding stream #0:0", models.JobErrorTransient},
+		{"disk full", context.Background(), exitErr("exit 1"), "segment003.ts: No space left on device", models.JobErrorTransient},
+		{"timeout or cancel", cancelled, exitErr("exit 1"), "Invalid data found when processing input", models.JobErrorTransient},
+		{"ffmpeg missing", context.Background(), exec.Command("ffmpeg-not-installed").Run(), "", models.JobErrorTransient},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ffmpegError(test.ctx, "FFmpeg failed", test.err, []byte(test.output))
+			if kind := errorKind(err); kind != test.want {
+				t.Errorf("kind = %s, want %s: %v", kind, test.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+	"video-feed/config"
+	"video-feed/internal/models"
+	"video-feed/pkg/storage"
+	"video-feed/pkg/utils/logger"
+)
+
+const (
+	jobPollInterval      = 5 * time.Second
+	jobHeartbeatInterval = 30 * time.Second
+	// Running jobs without a heartbeat for this long belong to a dead worker
+	jobStaleTimeout = 2 * time.Minute
+	maxRetryBackoff = time.Hour
+)
+
+// JobQueue stores transcode jobs and the leases workers hold on them.
+type JobQueue interface {
+	Create(job *models.TranscodeJob) error
+	ClaimNext(workerID string) (*models.TranscodeJob, error)
+	Heartbeat(jobID, workerID string) (bool, error)
+	Cancel(videoID string) (models.TranscodeJobState, error)
+	IsCancelled(jobID string) (bool, error)
+	Succeed(jobID, workerID string) (bool, error)
+	Fail(jobID string, state models.TranscodeJobState, attempt models.JobAttemptError, nextRunAt time.Time) (bool, error)
+	RequeueStale(timeout time.Duration) ([]models.TranscodeJob, error)
+	ListByState(state models.TranscodeJobState, limit, offset int) ([]models.TranscodeJob, error)
+	Retry(jobID string) (bool, error)
+	LatestByVideo(videoID string) (*models.TranscodeJob, error)
+}
+
+// TranscodeWorkerPool runs queued transcode jobs from the database with a
+// fixed number of workers, so at most Size ffmpeg pipelines run at once.
+type TranscodeWorkerPool struct {
+	Size         int
+	MaxAttempts  int
+	RetryBackoff time.Duration
+	Jobs         JobQueue
+	Storage      storage.StorageService
+	HLSJob       *HLSBackgroundJob
+
+	wake chan struct{}
+}
+
+func NewTranscodeWorkerPool(cfg *config.AppConfig, jobs JobQueue, storage storage.StorageService, hlsJob *HLSBackgroundJob) *TranscodeWorkerPool {
+	size := max(cfg.Env.TRANSCODE_WORKERS, 1)
+	return &TranscodeWorkerPool{
+		Size:         size,
+		MaxAttempts:  max(cfg.Env.TRANSCODE_MAX_ATTEMPTS, 1),
+		RetryBackoff: cfg.Env.TRANSCODE_RETRY_BACKOFF,
+		Jobs:         jobs,
+		Storage:      storage,
+		HLSJob:       hlsJob,
+		wake:         make(chan struct{}, size),
+	}
+}
+
+// Enqueue stores a job for the video and wakes an idle worker.
+func (p *TranscodeWorkerPool) Enqueue(jobID, videoID, inputPath string) error {
+	job := models.TranscodeJob{ID: jobID, VideoID: videoID, InputPath: inputPath, MaxAttempts: p.MaxAttempts}
+	if err := p.Jobs.Create(&job); err != nil {
+		return fmt.Errorf("failed to enqueue transcode job: %v", err)
+	}
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start launches the workers and the stale job reaper, they stop when ctx is done.
+func (p *TranscodeWorkerPool) Start(ctx context.Context) {
+	hostname, _ := os.Hostname()
+
+	go p.recoverStaleJobs(ctx)
+	for i := 0; i < p.Size; i++ {
+		workerID := fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), i)
+		go p.runWorker(ctx, workerID)
+	}
+	logger.Log.Infof("Started %d transcode workers", p.Size)
+}
+
+func (p *TranscodeWorkerPool) runWorker(ctx context.Context, workerID string) {
+	for {
+		job, err := p.Jobs.ClaimNext(workerID)
+		if err != nil {
+			logger.Log.Error("failed to claim transcode job: ", err)
+		}
+
+		if job != nil {
+			p.runJob(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.wake:
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+func (p *TranscodeWorkerPool) runJob(ctx context.Context, job *models.TranscodeJob) {
+	logger.Log.Infof("Worker claimed transcode job %s for video %s (attempt %d)", job.ID, job.VideoID, job.Attempts)
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	defer stopHeartbeat()
+	go p.heartbeat(heartbeatCtx, job)
+
+	workDir := filepath.Join("tmp", "jobs", job.ID)
+	defer os.RemoveAll(workDir)
+
+	result := HLSJobResult{VideoID: job.VideoID}
+	inputPath, err := p.downloadInput(job, workDir)
+	if err != nil {
+		result.Error = err
+	} else {
+		result = <-p.HLSJob.ProcessHLSWithTimeout(job.VideoID, inputPath)
+	}
+
+	// A cancelled job is neither failed nor done, whatever the pipeline returned
+	if cancelled, err := p.Jobs.IsCancelled(job.ID); err != nil {
+		logger.Log.Error("failed to check transcode job state: ", err)
+	} else if cancelled {
+		logger.Log.Infof("Transcode job %s for video %s was cancelled", job.ID, job.VideoID)
+		if err := p.HLSJob.CleanupCancelled(job.VideoID); err != nil {
+			logger.Log.Error("failed to clean up cancelled transcode: ", err)
+		}
+		return
+	}
+
+	if result.Success {
+		held, err := p.Jobs.Succeed(job.ID, job.WorkerID)
+		if err != nil {
+			logger.Log.Error("failed to finish transcode job: ", err)
+		} else if !held {
+			p.logLostLease(job)
+			return
+		}
+	} else {
+		state, recorded := p.failJob(job, result.Error)
+		if !recorded {
+			return
+		}
+		if state == models.JobQueued {
+			// The video keeps processing until the retry finishes
+			return
+		}
+	}
+
+	if err := p.HLSJob.HandleJobResult(result); err != nil {
+		logger.Log.Error("failed to update video after transcode: ", err)
+	}
+}
+
+// logLostLease reports an attempt whose job was taken over, its outcome is
+// dropped so it cannot overwrite the attempt that owns the job now.
+func (p *TranscodeWorkerPool) logLostLease(job *models.TranscodeJob) {
+	logger.Log.Warnf("Worker %s lost transcode job %s for video %s, dropping attempt %d", job.WorkerID, job.ID, job.VideoID, job.Attempts)
+}
+
+// failJob records the failed attempt and returns the state the job moved to.
+// recorded is false when the failure could not be stored or the worker no
+// longer owns the job, the video is left to whoever runs the job next.
+func (p *TranscodeWorkerPool) failJob(job *models.TranscodeJob, jobErr error) (state models.TranscodeJobState, recorded bool) {
+	if jobErr == nil {
+		jobErr = transientError("transcode failed without an error")
+	}
+
+	attempt := models.JobAttemptError{
+		Attempt:  job.Attempts,
+		Kind:     errorKind(jobErr),
+		Error:    jobErr.Error(),
+		WorkerID: job.WorkerID,
+		FailedAt: time.Now(),
+	}
+
+	state, nextRunAt := models.JobQueued, attempt.FailedAt.Add(p.backoff(job.Attempts))
+	switch {
+	case attempt.Kind == models.JobErrorPermanent:
+		state = models.JobFailed
+	case job.Attempts >= job.MaxAttempts:
+		state = models.JobDead
+	}
+
+	held, err := p.Jobs.Fail(job.ID, state, attempt, nextRunAt)
+	if err != nil {
+		// The job stays running until the reaper requeues it
+		logger.Log.Error("failed to record transcode failure: ", err)
+		return state, false
+	}
+	if !held {
+		p.logLostLease(job)
+		return state, false
+	}
+
+	if state == models.JobQueued {
+		logger.Log.Infof("Transcode job %s failed attempt %d/%d, retrying at %s: %v",
+			job.ID, job.Attempts, job.MaxAttempts, nextRunAt.Format(time.RFC3339), jobErr)
+		return state, true
+	}
+	logger.Log.Errorf("Transcode job %s is %s after %d attempts: %v", job.ID, state, job.Attempts, jobErr)
+	return state, true
+}
+
+// backoff doubles the delay after every attempt, capped at maxRetryBackoff.
+func (p *TranscodeWorkerPool) backoff(attempt int) time.Duration {
+	delay := p.RetryBackoff
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryBackoff)
+}
+
+// ListJobs returns jobs in a state, used to inspect the dead-letter queue.
+func (p *TranscodeWorkerPool) ListJobs(state models.TranscodeJobState, limit, offset int) ([]models.TranscodeJob, error) {
+	return p.Jobs.ListByState(state, limit, offset)
+}
+
+// RetryJob queues a failed or dead job again.
+func (p *TranscodeWorkerPool) RetryJob(jobID string) (bool, error) {
+	retried, err := p.Jobs.Retry(jobID)
+	if retried {
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+	return retried, err
+}
+
+// LatestJob returns the most recent job of a video, or nil when it has none.
+func (p *TranscodeWorkerPool) LatestJob(videoID string) (*models.TranscodeJob, error) {
+	return p.Jobs.LatestByVideo(videoID)
+}
+
+// downloadInput fetches the original upload, workers may run on another host
+// than the one that received it.
+func (p *TranscodeWorkerPool) downloadInput(job *models.TranscodeJob, workDir string) (string, error) {
+	if err := os.MkdirAll(workDir, os.ModePerm); err != nil {
+		return "", transientError("failed to create work directory: %v", err)
+	}
+
+	src, err := p.Storage.GetObject(job.InputPath)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return "", permanentError("input %s does not exist", job.InputPath)
+	}
+	if err != nil {
+		return "", transientError("failed to open input %s: %v", job.InputPath, err)
+	}
+	defer src.Close()
+
+	inputPath := filepath.Join(workDir, "input"+filepath.Ext(job.InputPath))
+	dst, err := os.Create(inputPath)
+	if err != nil {
+		return "", transientError("failed to create input file: %v", err)
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		return "", transientError("failed to download input %s: %v", job.InputPath, err)
+	}
+	return inputPath, nil
+}
+
+// heartbeat keeps the job claimed and stops its pipeline once the job was
+// cancelled from another process or handed to another worker.
+func (p *TranscodeWorkerPool) heartbeat(ctx context.Context, job *models.TranscodeJob) {
+	ticker := time.NewTicker(jobHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			running, err := p.Jobs.Heartbeat(job.ID, job.WorkerID)
+			if err != nil {
+				logger.Log.Error("failed to send job heartbeat: ", err)
+			} else if !running {
+				p.HLSJob.Cancel(job.VideoID)
+				return
+			}
+		}
+	}
+}
+
+func (p *TranscodeWorkerPool) recoverStaleJobs(ctx context.Context) {
+	ticker := time.NewTicker(jobStaleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		jobs, err := p.Jobs.RequeueStale(jobStaleTimeout)
+		if err != nil {
+			logger.Log.Error("failed to requeue stale transcode jobs: ", err)
+		} else if len(jobs) > 0 {
+			logger.Log.Infof("Requeued %d orphaned transcode jobs", len(jobs))
+		}
+
+		// Jobs out of attempts are dead, nobody else reports them on the video
+		for _, job := range jobs {
+			if job.State != models.JobDead {
+				continue
+			}
+			result := HLSJobResult{VideoID: job.VideoID, Error: errors.New(job.Error)}
+			if err := p.HLSJob.HandleJobResult(result); err != nil {
+				logger.Log.Error("failed to update video of dead transcode job: ", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
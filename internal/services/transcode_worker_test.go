@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+	"video-feed/config"
+	"video-feed/internal/models"
+)
+
+// memoryJobQueue records what workers report on their job, lost makes every
+// lease check fail as if another worker took the job over.
+type memoryJobQueue struct {
+	mu        sync.Mutex
+	lost      bool
+	succeeded bool
+	failures  []recordedFailure
+}
+
+type recordedFailure struct {
+	state     models.TranscodeJobState
+	attempt   models.JobAttemptError
+	nextRunAt time.Time
+}
+
+func (q *memoryJobQueue) Create(job *models.TranscodeJob) error { return nil }
+
+func (q *memoryJobQueue) ClaimNext(workerID string) (*models.TranscodeJob, error) { return nil, nil }
+
+func (q *memoryJobQueue) Heartbeat(jobID, workerID string) (bool, error) { return !q.lost, nil }
+
+func (q *memoryJobQueue) Cancel(videoID string) (models.TranscodeJobState, error) { return "", nil }
+
+func (q *memoryJobQueue) IsCancelled(jobID string) (bool, error) { return false, nil }
+
+func (q *memoryJobQueue) Succeed(jobID, workerID string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.lost {
+		return false, nil
+	}
+	q.succeeded = true
+	return true, nil
+}
+
+func (q *memoryJobQueue) Fail(jobID string, state models.TranscodeJobState, attempt models.JobAttemptError, nextRunAt time.Time) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.lost {
+		return false, nil
+	}
+	q.failures = append(q.failures, recordedFailure{state: state, attempt: attempt, nextRunAt: nextRunAt})
+	return true, nil
+}
+
+func (q *memoryJobQueue) RequeueStale(timeout time.Duration) ([]models.TranscodeJob, error) {
+	return nil, nil
+}
+
+func (q *memoryJobQueue) ListByState(state models.TranscodeJobState, limit, offset int) ([]models.TranscodeJob, error) {
+	return nil, nil
+}
+
+func (q *memoryJobQueue) Retry(jobID string) (bool, error) { return false, nil }
+
+func (q *memoryJobQueue) LatestByVideo(videoID string) (*models.TranscodeJob, error) {
+	return nil, nil
+}
+
+func testJob(attempts int) *models.TranscodeJob {
+	return &models.TranscodeJob{
+		ID:          "job1",
+		VideoID:     testVideoID,
+		InputPath:   videoPrefix(testVideoID) + "original.mp4",
+		State:       models.JobRunning,
+		Attempts:    attempts,
+		MaxAttempts: 3,
+		WorkerID:    "worker1",
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	pool := &TranscodeWorkerPool{RetryBackoff: time.Minute}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, maxRetryBackoff},
+		{40, maxRetryBackoff},
+	}
+	for _, test := range tests {
+		if got := pool.backoff(test.attempt); got != test.want {
+			t.Errorf("backoff(%d) = %s, want %s", test.attempt, got, test.want)
+		}
+	}
+}
+
+func TestFailJob(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		err      error
+		lost     bool
+		want     models.TranscodeJobState
+		recorded bool
+		backoff  time.Duration
+	}{
+		{"transient is retried", 1, transientError("FFmpeg failed, killed: signal: killed"), false, models.JobQueued, true, time.Minute},
+		{"retries back off", 2, transientError("upload failed"), false, models.JobQueued, true, 2 * time.Minute},
+		{"unclassified is retried", 1, context.DeadlineExceeded, false, models.JobQueued, true, time.Minute},
+		{"permanent fails at once", 1, permanentError("input has no video stream"), false, models.JobFailed, true, time.Minute},
+		{"last attempt is dead", 3, transientError("upload failed"), false, models.JobDead, true, 4 * time.Minute},
+		{"lost lease is not recorded", 1, transientError("upload failed"), true, models.JobQueued, false, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queue := &memoryJobQueue{lost: test.lost}
+			pool := &TranscodeWorkerPool{RetryBackoff: time.Minute, Jobs: queue}
+
+			state, recorded := pool.failJob(testJob(test.attempts), test.err)
+			if state != test.want || recorded != test.recorded {
+				t.Fatalf("failJob = %s, %t, want %s, %t", state, recorded, test.want, test.recorded)
+			}
+			if !recorded {
+				if len(queue.failures) != 0 {
+					t.Errorf("recorded %+v", queue.failures)
+				}
+				return
+			}
+
+			failure := queue.failures[0]
+			if failure.state != test.want || failure.attempt.Attempt != test.attempts || failure.attempt.WorkerID != "worker1" {
+				t.Errorf("recorded %+v", failure)
+			}
+			if failure.attempt.Kind != errorKind(test.err) || failure.attempt.Error != test.err.Error() {
+				t.Errorf("recorded error %s %q", failure.attempt.Kind, failure.attempt.Error)
+			}
+			if delay := failure.nextRunAt.Sub(failure.attempt.FailedAt); delay != test.backoff {
+				t.Errorf("next run after %s, want %s", delay, test.backoff)
+			}
+		})
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	tests := []struct {
+		name       string
+		attempts   int
+		encodeErr  error
+		want       models.TranscodeJobState
+		videoError bool
+	}{
+		// The video keeps processing while a retry is pending
+		{"transient failure is retried", 1, transientError("FFmpeg failed, killed: signal: killed"), models.JobQueued, false},
+		{"permanent failure", 1, permanentError("FFmpeg failed: exit status 1, output: moov atom not found"), models.JobFailed, true},
+		{"out of attempts", 3, transientError("FFmpeg failed, killed: signal: killed"), models.JobDead, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transcoder := NewFakeTranscoder(testMediaInfo())
+			transcoder.EncodeErr = test.encodeErr
+			p := newPipelineTest(t, config.Env{}, transcoder)
+			queue := &memoryJobQueue{}
+			pool := &TranscodeWorkerPool{RetryBackoff: time.Minute, Jobs: queue, Storage: p.storage, HLSJob: p.job}
+
+			pool.runJob(context.Background(), testJob(test.attempts))
+
+			if queue.succeeded || len(queue.failures) != 1 || queue.failures[0].state != test.want {
+				t.Fatalf("succeeded %t, failures %+v, want %s", queue.succeeded, queue.failures, test.want)
+			}
+			video := p.videos.video(testVideoID)
+			if (video.ProcessingError != "") != test.videoError || video.HLSProcessed {
+				t.Errorf("video processed %t, error %q", video.HLSProcessed, video.ProcessingError)
+			}
+		})
+	}
+}
+
+func TestRunJobSucceeds(t *testing.T) {
+	p := newPipelineTest(t, config.Env{}, NewFakeTranscoder(testMediaInfo()))
+	queue := &memoryJobQueue{}
+	pool := &TranscodeWorkerPool{RetryBackoff: time.Minute, Jobs: queue, Storage: p.storage, HLSJob: p.job}
+
+	pool.runJob(context.Background(), testJob(1))
+
+	if !queue.succeeded || len(queue.failures) != 0 {
+		t.Fatalf("succeeded %t, failures %+v", queue.succeeded, queue.failures)
+	}
+	if video := p.videos.video(testVideoID); !video.HLSProcessed || !video.Playable {
+		t.Errorf("video processed %t, playable %t", video.HLSProcessed, video.Playable)
+	}
+}
+
+func TestRunJobLostLease(t *testing.T) {
+	p := newPipelineTest(t, config.Env{}, NewFakeTranscoder(testMediaInfo()))
+	queue := &memoryJobQueue{lost: true}
+	pool := &TranscodeWorkerPool{RetryBackoff: time.Minute, Jobs: queue, Storage: p.storage, HLSJob: p.job}
+
+	pool.runJob(context.Background(), testJob(1))
+
+	// The worker that owns the job now reports on the video
+	if video := p.videos.video(testVideoID); video.HLSProcessed {
+		t.Error("attempt without the lease marked the video processed")
+	}
+}
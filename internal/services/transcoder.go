@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"video-feed/config"
+	"video-feed/internal/models"
+)
+
+// Transcoder runs the media tools of the HLS pipeline. FFmpegTranscoder is
+// the real implementation, tests use a fake that writes deterministic output
+// so the pipeline runs without ffmpeg.
+type Transcoder interface {
+	// Probe describes the input and rejects files that cannot be transcoded.
+	Probe(ctx context.Context, inputPath string) (models.MediaInfo, error)
+	// ProbeStreams lists the streams of an encoded rendition playlist.
+	ProbeStreams(ctx context.Context, playlistPath string) ([]StreamInfo, error)
+	// DetectSilence reports whether the first audio stream is digital silence.
+	DetectSilence(ctx context.Context, inputPath string) (bool, error)
+	// MeasureComplexity encodes samples of the input at a constant quality
+	// and returns the bitrate that took, in bits per second.
+	MeasureComplexity(ctx context.Context, inputPath string, spec ComplexitySpec) (int, error)
+	// EncodeRendition encodes one HLS rendition, playlist.m3u8 and its
+	// segments, into spec.OutputDir.
+	EncodeRendition(ctx context.Context, inputPath string, spec RenditionSpec) error
+	// EncodeLadder decodes the input once and encodes a video rendition per
+	// rung into spec.OutputDir/{rung name}, listed in spec.OutputDir/master.m3u8.
+	EncodeLadder(ctx context.Context, inputPath string, spec LadderSpec) error
+	// SceneScores scores the frames of a window of the input by how much
+	// they differ from the frame before, frames scoring at most
+	// spec.Threshold are left out.
+	SceneScores(ctx context.Context, inputPath string, spec SceneSpec) ([]SceneScore, error)
+	// ExtractFrames renders frames of the input through a filter graph.
+	ExtractFrames(ctx context.Context, inputPath string, spec FrameSpec) error
+	// PackageDASH remuxes MPEG-TS renditions into a DASH presentation.
+	PackageDASH(ctx context.Context, spec DASHSpec) error
+}
+
+// RenditionSpec describes an HLS rendition. A nil Video encodes audio only,
+// an empty AudioBitrate encodes video only.
+type RenditionSpec struct {
+	OutputDir    string
+	Video        *config.LadderRung
+	AudioBitrate string
+	// SegmentType is mpegts or fmp4, fmp4 adds an init.mp4
+	SegmentType     string
+	SegmentDuration int
+	// GOPSize, when set, fixes the keyframe interval in frames
+	GOPSize int
+	// Progress, when set, is called with the seconds of output encoded so far
+	Progress func(encoded float64)
+}
+
+// LadderSpec describes the video renditions of one encode. Every rung uses
+// the same GOPSize so segment boundaries line up across variants.
+type LadderSpec struct {
+	OutputDir       string
+	Rungs           []config.LadderRung
+	SegmentType     string
+	SegmentDuration int
+	GOPSize         int
+	// Progress, when set, is called with the seconds of output encoded so far
+	Progress func(encoded float64)
+}
+
+// ComplexitySpec describes the CRF probe encode of a complexity analysis.
+type ComplexitySpec struct {
+	// WorkDir holds the sample encodes while they are measured
+	WorkDir string
+	Height  int
+	CRF     int
+	// Samples are the start times of the sampled segments in seconds
+	Samples        []float64
+	SampleDuration float64
+}
+
+// SceneSpec describes the window of the input SceneScores looks at.
+type SceneSpec struct {
+	// Seek and Duration are in seconds
+	Seek      float64
+	Duration  float64
+	Threshold float64
+}
+
+// SceneScore is the scene change score, 0 to 1, of the frame at Time seconds.
+type SceneScore struct {
+	Time  float64
+	Score float64
+}
+
+// FrameSpec describes a frame extraction. OutputPath may hold a printf
+// pattern like sprite_%03d.jpg when the filter yields several images.
+type FrameSpec struct {
+	// Seek skips this many seconds of the input
+	Seek float64
+	// Filter is an ffmpeg filter graph, empty keeps frames as decoded
+	Filter string
+	// MaxFrames limits the number of frames written, 0 writes all of them
+	MaxFrames int
+	// Quality is the JPEG qscale (lower is better) or the WebP quality
+	Quality    int
+	OutputPath string
+}
+
+// DASHSpec lists the renditions to remux. AudioPlaylist is empty for videos
+// without audio.
+type DASHSpec struct {
+	VideoPlaylists  []string
+	AudioPlaylist   string
+	SegmentDuration int
+	ManifestPath    string
+}
+
+// StreamInfo is what the pipeline needs to know about an encoded stream.
+type StreamInfo struct {
+	CodecType string
+	CodecName string
+	Profile   string
+	Level     int
+	Width     int
+	Height    int
+	FrameRate float64
+	// BitDepth of the video samples, 8 unless ffprobe reports more
+	BitDepth int
+}
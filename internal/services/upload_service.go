@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"video-feed/pkg/storage"
+)
+
+// uploadOutput publishes the output directory of a video, or only the given
+// files and directories of it. Segments, init segments and images go first,
+// then rendition playlists and manifests, and the master playlist last. A
+// playlist is only uploaded once everything it references is stored, so
+// players never see it point at missing segments.
+func (h *HLSBackgroundJob) uploadOutput(ctx context.Context, videoID, outputDir string, roots ...string) error {
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+
+	var media, playlists, masters []storage.FileUpload
+	for _, root := range roots {
+		err := filepath.Walk(filepath.Join(outputDir, root), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || !h.isPublishedFile(path) {
+				return nil
+			}
+
+			relativePath, err := filepath.Rel(outputDir, path)
+			if err != nil {
+				return err
+			}
+			upload := storage.FileUpload{
+				ObjectName: videoPrefix(videoID) + filepath.ToSlash(relativePath),
+				Path:       path,
+			}
+
+			switch {
+			case relativePath == "master.m3u8":
+				masters = append(masters, upload)
+			case isPlaylist(path):
+				playlists = append(playlists, upload)
+			default:
+				media = append(media, upload)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, batch := range [][]storage.FileUpload{media, playlists, masters} {
+		if err := h.Uploader.Upload(ctx, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isPlaylist(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".m3u8", ".mpd":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"video-feed/config"
+	"video-feed/pkg/storage"
+)
+
+// orderedStorage records the order objects were stored in.
+type orderedStorage struct {
+	storage.StorageService
+
+	mu     sync.Mutex
+	stored []string
+}
+
+func (s *orderedStorage) UploadObject(objectName string, reader io.Reader, size int64, opts storage.UploadOptions) error {
+	if err := s.StorageService.UploadObject(objectName, reader, size, opts); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stored = append(s.stored, strings.TrimPrefix(objectName, videoPrefix(testVideoID)))
+	return nil
+}
+
+func TestUploadOutputStoresPlaylistsLast(t *testing.T) {
+	p := newPipelineTest(t, config.Env{OUTPUT_FORMATS: []string{"hls", "dash"}, HLS_SEGMENT_TYPE: "fmp4"}, NewFakeTranscoder(testMediaInfo()))
+	recorder := &orderedStorage{StorageService: p.storage}
+	p.job.Uploader = storage.NewParallelUploader(recorder, 4, 1)
+
+	outputDir := t.TempDir()
+	files := []string{
+		"master.m3u8",
+		"480p/playlist.m3u8", "480p/init.mp4", "480p/segment000.m4s", "480p/segment001.m4s",
+		"720p/playlist.m3u8", "720p/init.mp4", "720p/segment000.m4s", "720p/segment001.m4s",
+		"audio/playlist.m3u8", "audio/init.mp4", "audio/segment000.m4s",
+		"dash/manifest.mpd",
+		// Scratch files are never published
+		"480p/ffmpeg.log",
+	}
+	writeOutputFiles(t, outputDir, files)
+
+	if err := p.job.uploadOutput(context.Background(), testVideoID, outputDir); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := recorder.stored
+	if len(stored) != len(files)-1 || slices.Contains(stored, "480p/ffmpeg.log") {
+		t.Fatalf("stored %v", stored)
+	}
+	if stored[len(stored)-1] != "master.m3u8" {
+		t.Errorf("master playlist was not stored last: %v", stored)
+	}
+	firstPlaylist := slices.IndexFunc(stored, isPlaylist)
+	for i, name := range stored {
+		if !isPlaylist(name) && i > firstPlaylist {
+			t.Errorf("%s was stored after a playlist: %v", name, stored)
+		}
+	}
+}
+
+func TestUploadOutputOfOneRendition(t *testing.T) {
+	p := newPipelineTest(t, config.Env{}, NewFakeTranscoder(testMediaInfo()))
+	recorder := &orderedStorage{StorageService: p.storage}
+	p.job.Uploader = storage.NewParallelUploader(recorder, 4, 1)
+
+	outputDir := t.TempDir()
+	writeOutputFiles(t, outputDir, []string{"master.m3u8", "480p/playlist.m3u8", "480p/segment000.ts", "720p/playlist.m3u8", "720p/segment000.ts"})
+
+	if err := p.job.uploadOutput(context.Background(), testVideoID, outputDir, "480p"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"480p/segment000.ts", "480p/playlist.m3u8"}; !slices.Equal(recorder.stored, want) {
+		t.Errorf("stored %v, want %v", recorder.stored, want)
+	}
+}
+
+func writeOutputFiles(t *testing.T, outputDir string, names []string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(outputDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
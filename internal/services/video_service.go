@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 	"video-feed/config"
 	"video-feed/internal/dto"
@@ -18,17 +21,24 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// Part URLs stay valid as long as the upload session itself
+const directUploadExpiry = 24 * time.Hour
+
 type VideoService struct {
-	repo    *repositories.VideoRepository
-	storage storage.StorageService
-	cfg     *config.AppConfig
+	repo      *repositories.VideoRepository
+	subtitles *repositories.SubtitleRepository
+	storage   storage.StorageService
+	cfg       *config.AppConfig
+	queue     *TranscodeWorkerPool
 }
 
-func NewVideoService(repo *repositories.VideoRepository, storage storage.StorageService, cfg *config.AppConfig) *VideoService {
+func NewVideoService(repo *repositories.VideoRepository, subtitles *repositories.SubtitleRepository, storage storage.StorageService, cfg *config.AppConfig, queue *TranscodeWorkerPool) *VideoService {
 	return &VideoService{
-		repo:    repo,
-		storage: storage,
-		cfg:     cfg,
+		repo:      repo,
+		subtitles: subtitles,
+		storage:   storage,
+		cfg:       cfg,
+		queue:     queue,
 	}
 }
 
@@ -52,23 +62,16 @@ func (vs *VideoService) UploadVideo(c *gin.Context) (models.Video, error) {
 	videoID := utils.GenerateUniqueID()
 	originalPath := "videos/" + videoID + "/original" + mtype.Extension()
 
-	tmpFilePath := "tmp/" + videoID + mtype.Extension()
-	tmpFile, err := os.Create(tmpFilePath)
-	if err != nil {
-		return models.Video{}, fmt.Errorf("failed to create temporary file: %v", err)
-	}
-	defer tmpFile.Close()
-
 	_, err = srcFile.Seek(0, 0)
 	if err != nil {
 		return models.Video{}, fmt.Errorf("failed to reset file pointer: %v", err)
 	}
-	_, err = tmpFile.ReadFrom(srcFile)
-	if err != nil {
-		return models.Video{}, fmt.Errorf("failed to write video to temp file: %v", err)
-	}
 
-	err = vs.storage.UploadObject(originalPath, tmpFile)
+	// Stream the form file straight to storage
+	err = vs.storage.UploadObject(originalPath, srcFile, file.Size, storage.UploadOptions{
+		ContentType: mtype.String(),
+		Metadata:    map[string]string{"Original-Filename": file.Filename},
+	})
 	if err != nil {
 		return models.Video{}, fmt.Errorf("failed to upload video to S3: %v", err)
 	}
@@ -76,8 +79,8 @@ func (vs *VideoService) UploadVideo(c *gin.Context) (models.Video, error) {
 	video := models.Video{
 		ID:           videoID,
 		UserID:       utils.GetUserID(c),
-		OriginalURL:  vs.cfg.Env.CDN_URL + originalPath,
-		HLSURL:       vs.cfg.Env.CDN_URL + "videos/" + videoID + "/playlist.m3u8",
+		OriginalURL:  originalPath,
+		HLSURL:       "videos/" + videoID + "/playlist.m3u8",
 		CreatedAt:    time.Now(),
 		Description:  c.PostForm("description"),
 		Qualities:    []string{"original"},
@@ -88,25 +91,32 @@ func (vs *VideoService) UploadVideo(c *gin.Context) (models.Video, error) {
 		return models.Video{}, fmt.Errorf("failed to save video metadata: %v", err)
 	}
 
+	vs.presentVideo(&video)
 	return video, nil
 }
 
 func (vs *VideoService) ListVideo(c *gin.Context) ([]models.Video, error) {
 	videos, err := vs.repo.ListUserVideos(utils.GetUserID(c), 100, 0)
-	return videos, err
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range videos {
+		vs.presentVideo(&videos[i])
+	}
+	return videos, nil
 }
 
-func (vs *VideoService) InitiateChunkUpload(dto dto.InitiateChunkDTO) (string, error) {
+func (vs *VideoService) InitiateChunkUpload(requestData dto.InitiateChunkDTO) (dto.InitiateChunkResponse, error) {
 	uploadID := utils.GenerateUniqueID()
-	fileName := dto.FileName
-	totalChunks := dto.TotalChunks
-
-	println("anjeng", fileName, uploadID, totalChunks)
+	fileName := requestData.FileName
+	totalChunks := requestData.TotalChunks
+	response := dto.InitiateChunkResponse{UploadID: uploadID, Mode: "chunked"}
 
 	// Create directory for this upload
 	uploadDir := fmt.Sprintf("tmp/uploads/%s", uploadID)
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		return "", err
+		return response, err
 	}
 
 	// Save upload info to JSON file
@@ -117,17 +127,53 @@ func (vs *VideoService) InitiateChunkUpload(dto dto.InitiateChunkDTO) (string, e
 		CreatedAt:   time.Now(),
 	}
 
+	// Open a multipart upload in the bucket when the client and the provider support it
+	uploader, ok := vs.storage.(storage.MultipartUploader)
+	if requestData.Direct && ok && totalChunks > 0 {
+		partURLs, err := vs.initiateDirectUpload(uploader, &sessionInfo, requestData.ContentType)
+		if err != nil {
+			return response, err
+		}
+		response.Mode = "direct"
+		response.PartURLs = partURLs
+	}
+
 	infoFile := fmt.Sprintf("%s/info.json", uploadDir)
 	infoData, err := json.Marshal(sessionInfo)
 	if err != nil {
-		return "", err
+		return response, err
 	}
 
 	if err := os.WriteFile(infoFile, infoData, 0644); err != nil {
-		return "", err
+		return response, err
+	}
+
+	return response, nil
+}
+
+func (vs *VideoService) initiateDirectUpload(uploader storage.MultipartUploader, sessionInfo *models.ChunkInfo, contentType string) ([]string, error) {
+	videoID := utils.GenerateUniqueID()
+	objectName := "videos/" + videoID + "/original" + strings.ToLower(filepath.Ext(sessionInfo.FileName))
+
+	storageUploadID, err := uploader.CreateMultipartUpload(objectName, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	partURLs := make([]string, sessionInfo.TotalChunks)
+	for i := range partURLs {
+		partURLs[i], err = uploader.PresignUploadPart(objectName, storageUploadID, i+1, directUploadExpiry)
+		if err != nil {
+			uploader.AbortMultipartUpload(objectName, storageUploadID)
+			return nil, err
+		}
 	}
 
-	return uploadID, nil
+	sessionInfo.Direct = true
+	sessionInfo.VideoID = videoID
+	sessionInfo.ObjectName = objectName
+	sessionInfo.StorageUploadID = storageUploadID
+	return partURLs, nil
 }
 
 func (vs *VideoService) SaveChunk(file *multipart.FileHeader, chunkPath string) error {
@@ -179,37 +225,26 @@ func (vs *VideoService) CompleteChunkUpload(dto dto.CompleteChunkUploadDTO, user
 		return nil, fmt.Errorf("invalid or expired upload session")
 	}
 
+	if sessionInfo.Direct {
+		return vs.completeDirectUpload(sessionInfo, uploadDir, dto.Description, userId)
+	}
+
 	// Verify all chunks are present
+	var totalSize int64
 	for i := 0; i < sessionInfo.TotalChunks; i++ {
 		chunkPath := fmt.Sprintf("%s/chunk_%d", uploadDir, i)
-		if _, err := os.Stat(chunkPath); os.IsNotExist(err) {
+		info, err := os.Stat(chunkPath)
+		if os.IsNotExist(err) {
 			return nil, fmt.Errorf("missing chunk %d", i)
 		}
-	}
-
-	// Combine chunks
-	finalPath := fmt.Sprintf("tmp/%s_%s", uploadID, sessionInfo.FileName)
-	finalFile, err := os.Create(finalPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create final file")
-	}
-	defer finalFile.Close()
-
-	// Combine all chunks in order
-	for i := 0; i < sessionInfo.TotalChunks; i++ {
-		chunkPath := fmt.Sprintf("%s/chunk_%d", uploadDir, i)
-		chunkData, err := os.ReadFile(chunkPath)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read chunk")
 		}
-		if _, err := finalFile.Write(chunkData); err != nil {
-			return nil, fmt.Errorf("failed to write chunk to final file")
-		}
+		totalSize += info.Size()
 	}
 
-	// Get file type
-	finalFile.Seek(0, 0)
-	mtype, err := mimetype.DetectReader(finalFile)
+	// Get file type from the first chunk
+	mtype, err := mimetype.DetectFile(fmt.Sprintf("%s/chunk_0", uploadDir))
 	if err != nil {
 		return nil, fmt.Errorf("failed to detect file type")
 	}
@@ -218,19 +253,27 @@ func (vs *VideoService) CompleteChunkUpload(dto dto.CompleteChunkUploadDTO, user
 	videoID := utils.GenerateUniqueID()
 	originalPath := "videos/" + videoID + "/original" + mtype.Extension()
 
-	// Upload to S3
-	finalFile.Seek(0, 0)
-	err = vs.storage.UploadObject(originalPath, finalFile)
+	// Stream all chunks in order to storage, without combining them on disk
+	chunks := &chunkReader{}
+	for i := 0; i < sessionInfo.TotalChunks; i++ {
+		chunks.paths = append(chunks.paths, fmt.Sprintf("%s/chunk_%d", uploadDir, i))
+	}
+	defer chunks.Close()
+
+	err = vs.storage.UploadObject(originalPath, chunks, totalSize, storage.UploadOptions{
+		ContentType: mtype.String(),
+		Metadata:    map[string]string{"Original-Filename": sessionInfo.FileName},
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload to storage: %v", err)
 	}
+	defer os.RemoveAll(uploadDir) // Clean up chunks
 
 	// Create video record
-	cdnUrl := vs.cfg.Env.CDN_URL
 	video := models.Video{
 		ID:           videoID,
 		UserID:       userId,
-		OriginalURL:  cdnUrl + originalPath,
+		OriginalURL:  originalPath,
 		HLSURL:       "",
 		CreatedAt:    time.Now(),
 		Description:  dto.Description,
@@ -238,24 +281,97 @@ func (vs *VideoService) CompleteChunkUpload(dto dto.CompleteChunkUploadDTO, user
 		HLSProcessed: false,
 	}
 
-	if err := vs.repo.Create(&video); err != nil {
-		return nil, fmt.Errorf("failed to save video metadata")
+	if err := vs.createAndEnqueue(&video); err != nil {
+		return nil, err
 	}
 
-	// Start HLS processing in background
-	hlsJob := NewHLSBackgroundJob(vs.cfg, vs.storage, vs.repo)
+	vs.presentVideo(&video)
+	return &video, nil
+}
 
-	go func() {
-		defer os.RemoveAll(uploadDir) // Clean up chunks
-		defer os.Remove(finalPath)    // Clean up final file
+func (vs *VideoService) completeDirectUpload(sessionInfo *models.ChunkInfo, uploadDir, description, userId string) (*models.Video, error) {
+	uploader, ok := vs.storage.(storage.MultipartUploader)
+	if !ok {
+		return nil, fmt.Errorf("storage provider does not support direct uploads")
+	}
 
-		resultChan := hlsJob.ProcessHLSWithTimeout(videoID, finalPath)
-		result := <-resultChan
+	// Assemble the parts the client uploaded to the bucket
+	err := uploader.CompleteMultipartUpload(sessionInfo.ObjectName, sessionInfo.StorageUploadID, sessionInfo.TotalChunks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete upload: %v", err)
+	}
+	defer os.RemoveAll(uploadDir)
 
-		err := hlsJob.HandleJobResult(result)
-		if err != nil {
-			println(err.Error())
-		}
-	}()
+	video := models.Video{
+		ID:           sessionInfo.VideoID,
+		UserID:       userId,
+		OriginalURL:  sessionInfo.ObjectName,
+		HLSURL:       "",
+		CreatedAt:    time.Now(),
+		Description:  description,
+		Qualities:    []string{"original"},
+		HLSProcessed: false,
+	}
+
+	if err := vs.createAndEnqueue(&video); err != nil {
+		return nil, err
+	}
+
+	vs.presentVideo(&video)
 	return &video, nil
 }
+
+// createAndEnqueue saves the video and queues HLS processing of its original.
+func (vs *VideoService) createAndEnqueue(video *models.Video) error {
+	if err := vs.repo.Create(video); err != nil {
+		return fmt.Errorf("failed to save video metadata")
+	}
+
+	if err := vs.queue.Enqueue(utils.GenerateUniqueID(), video.ID, video.OriginalURL); err != nil {
+		return err
+	}
+	return nil
+}
+
+// chunkReader reads the chunk files of an upload one after the other. Only the
+// chunk being read is open, so large uploads do not run out of descriptors.
+type chunkReader struct {
+	paths   []string
+	current *os.File
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.paths) == 0 {
+				return 0, io.EOF
+			}
+			chunk, err := os.Open(r.paths[0])
+			if err != nil {
+				return 0, fmt.Errorf("failed to read chunk: %v", err)
+			}
+			r.current, r.paths = chunk, r.paths[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Close closes the chunk being read, if any
+func (r *chunkReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
@@ -0,0 +1,183 @@
+// Package dash writes static MPEG-DASH manifests for segments produced by the
+// HLS packager, so both formats can be served from one set of fMP4 segments.
+package dash
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Segment durations are written in milliseconds
+const timescale = 1000
+
+type Segment struct {
+	URI      string
+	Duration float64
+}
+
+type Representation struct {
+	ID        string
+	Bandwidth int64
+	Codecs    string
+	Width     int
+	Height    int
+	FrameRate float64
+	// InitURI is the initialization segment shared by all media segments
+	InitURI  string
+	Segments []Segment
+}
+
+type AdaptationSet struct {
+	ContentType     string
+	MimeType        string
+	Lang            string
+	Representations []Representation
+}
+
+type mpd struct {
+	XMLName                   xml.Name `xml:"urn:mpeg:dash:schema:mpd:2011 MPD"`
+	Profiles                  string   `xml:"profiles,attr"`
+	Type                      string   `xml:"type,attr"`
+	MediaPresentationDuration string   `xml:"mediaPresentationDuration,attr"`
+	MaxSegmentDuration        string   `xml:"maxSegmentDuration,attr"`
+	MinBufferTime             string   `xml:"minBufferTime,attr"`
+	Period                    period   `xml:"Period"`
+}
+
+type period struct {
+	ID             string          `xml:"id,attr"`
+	Start          string          `xml:"start,attr"`
+	AdaptationSets []adaptationSet `xml:"AdaptationSet"`
+}
+
+type adaptationSet struct {
+	ID               int              `xml:"id,attr"`
+	ContentType      string           `xml:"contentType,attr,omitempty"`
+	MimeType         string           `xml:"mimeType,attr"`
+	Lang             string           `xml:"lang,attr,omitempty"`
+	SegmentAlignment bool             `xml:"segmentAlignment,attr"`
+	Representations  []representation `xml:"Representation"`
+}
+
+type representation struct {
+	ID          string      `xml:"id,attr"`
+	Bandwidth   int64       `xml:"bandwidth,attr"`
+	Codecs      string      `xml:"codecs,attr,omitempty"`
+	Width       int         `xml:"width,attr,omitempty"`
+	Height      int         `xml:"height,attr,omitempty"`
+	FrameRate   string      `xml:"frameRate,attr,omitempty"`
+	SegmentList segmentList `xml:"SegmentList"`
+}
+
+type segmentList struct {
+	Timescale       int             `xml:"timescale,attr"`
+	Initialization  *initialization `xml:"Initialization,omitempty"`
+	SegmentTimeline []timelineEntry `xml:"SegmentTimeline>S"`
+	SegmentURLs     []segmentURL    `xml:"SegmentURL"`
+}
+
+type initialization struct {
+	SourceURL string `xml:"sourceURL,attr"`
+}
+
+type timelineEntry struct {
+	Duration int64 `xml:"d,attr"`
+	Repeat   int   `xml:"r,attr,omitempty"`
+}
+
+type segmentURL struct {
+	Media string `xml:"media,attr"`
+}
+
+// Write writes a static, single period manifest. Segments are listed
+// explicitly so every URL can be signed when the manifest is served.
+func Write(w io.Writer, duration float64, adaptationSets []AdaptationSet) error {
+	manifest := mpd{
+		Profiles:                  "urn:mpeg:dash:profile:isoff-main:2011",
+		Type:                      "static",
+		MediaPresentationDuration: formatDuration(duration),
+		MinBufferTime:             "PT2S",
+		Period:                    period{ID: "0", Start: "PT0S"},
+	}
+
+	var maxSegmentDuration float64
+	for i, set := range adaptationSets {
+		out := adaptationSet{
+			ID:               i,
+			ContentType:      set.ContentType,
+			MimeType:         set.MimeType,
+			Lang:             set.Lang,
+			SegmentAlignment: true,
+		}
+		for _, rep := range set.Representations {
+			list := segmentList{Timescale: timescale}
+			if rep.InitURI != "" {
+				list.Initialization = &initialization{SourceURL: rep.InitURI}
+			}
+
+			var start float64
+			for _, segment := range rep.Segments {
+				// Round segment boundaries, not durations, so the timeline does not drift
+				d := toTimescale(start+segment.Duration) - toTimescale(start)
+				start += segment.Duration
+				maxSegmentDuration = math.Max(maxSegmentDuration, segment.Duration)
+
+				if n := len(list.SegmentTimeline); n > 0 && list.SegmentTimeline[n-1].Duration == d {
+					list.SegmentTimeline[n-1].Repeat++
+				} else {
+					list.SegmentTimeline = append(list.SegmentTimeline, timelineEntry{Duration: d})
+				}
+				list.SegmentURLs = append(list.SegmentURLs, segmentURL{Media: segment.URI})
+			}
+
+			out.Representations = append(out.Representations, representation{
+				ID:          rep.ID,
+				Bandwidth:   rep.Bandwidth,
+				Codecs:      rep.Codecs,
+				Width:       rep.Width,
+				Height:      rep.Height,
+				FrameRate:   formatFrameRate(rep.FrameRate),
+				SegmentList: list,
+			})
+		}
+		manifest.Period.AdaptationSets = append(manifest.Period.AdaptationSets, out)
+	}
+	manifest.MaxSegmentDuration = formatDuration(maxSegmentDuration)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func toTimescale(seconds float64) int64 {
+	return int64(math.Round(seconds * timescale))
+}
+
+// formatDuration formats seconds as an xs:duration like PT12.345S.
+func formatDuration(seconds float64) string {
+	return "PT" + strconv.FormatFloat(math.Round(seconds*1000)/1000, 'f', -1, 64) + "S"
+}
+
+// formatFrameRate writes NTSC rates as fractions, e.g. 30000/1001.
+func formatFrameRate(rate float64) string {
+	if rate <= 0 {
+		return ""
+	}
+	if rounded := math.Round(rate); math.Abs(rate-rounded) < 0.001 {
+		return strconv.Itoa(int(rounded))
+	}
+	if ntsc := math.Round(rate * 1.001); math.Abs(rate-ntsc/1.001) < 0.001 {
+		return fmt.Sprintf("%d/1001", int(ntsc*1000))
+	}
+	return fmt.Sprintf("%d/1000", int(math.Round(rate*1000)))
+}
@@ -0,0 +1,181 @@
+package m3u8
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Variant is an EXT-X-STREAM-INF entry of a master playlist.
+type Variant struct {
+	URI string
+	// Bandwidth is the peak segment bit rate, AverageBandwidth is optional
+	Bandwidth        int64
+	AverageBandwidth int64
+	// Codecs are RFC 6381 codec strings
+	Codecs    []string
+	Width     int
+	Height    int
+	FrameRate float64
+	// Audio and Subtitles are the GROUP-IDs of the renditions the variant plays with
+	Audio     string
+	Subtitles string
+}
+
+// Media is an EXT-X-MEDIA rendition shared by variants through its group.
+type Media struct {
+	Type       string
+	GroupID    string
+	Name       string
+	Language   string
+	Default    bool
+	AutoSelect bool
+	Channels   string
+	URI        string
+}
+
+// MasterPlaylist lists the variants of a presentation.
+type MasterPlaylist struct {
+	Version             int
+	IndependentSegments bool
+	Media               []Media
+	Variants            []Variant
+}
+
+// WriteTo writes the playlist, attributes follow the order of RFC 8216.
+func (p *MasterPlaylist) WriteTo(w io.Writer) (int64, error) {
+	return p.encode().WriteTo(w)
+}
+
+// Bytes returns the encoded playlist.
+func (p *MasterPlaylist) Bytes() []byte {
+	return p.encode().Bytes()
+}
+
+func (p *MasterPlaylist) encode() *bytes.Buffer {
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n")
+	if p.Version > 0 {
+		fmt.Fprintf(&b, "#EXT-X-VERSION:%d\n", p.Version)
+	}
+	if p.IndependentSegments {
+		b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	}
+
+	for _, media := range p.Media {
+		attributes := []string{
+			"TYPE=" + media.Type,
+			`GROUP-ID="` + media.GroupID + `"`,
+			`NAME="` + media.Name + `"`,
+		}
+		if media.Language != "" {
+			attributes = append(attributes, `LANGUAGE="`+media.Language+`"`)
+		}
+		attributes = append(attributes, "DEFAULT="+yesNo(media.Default), "AUTOSELECT="+yesNo(media.AutoSelect))
+		if media.Channels != "" {
+			attributes = append(attributes, `CHANNELS="`+media.Channels+`"`)
+		}
+		if media.URI != "" {
+			attributes = append(attributes, `URI="`+media.URI+`"`)
+		}
+		fmt.Fprintf(&b, "#EXT-X-MEDIA:%s\n", strings.Join(attributes, ","))
+	}
+
+	for _, variant := range p.Variants {
+		attributes := []string{"BANDWIDTH=" + strconv.FormatInt(variant.Bandwidth, 10)}
+		if variant.AverageBandwidth > 0 {
+			attributes = append(attributes, "AVERAGE-BANDWIDTH="+strconv.FormatInt(variant.AverageBandwidth, 10))
+		}
+		if len(variant.Codecs) > 0 {
+			attributes = append(attributes, `CODECS="`+strings.Join(variant.Codecs, ",")+`"`)
+		}
+		if variant.Width > 0 && variant.Height > 0 {
+			attributes = append(attributes, fmt.Sprintf("RESOLUTION=%dx%d", variant.Width, variant.Height))
+		}
+		if variant.FrameRate > 0 {
+			attributes = append(attributes, "FRAME-RATE="+strconv.FormatFloat(variant.FrameRate, 'f', 3, 64))
+		}
+		if variant.Audio != "" {
+			attributes = append(attributes, `AUDIO="`+variant.Audio+`"`)
+		}
+		if variant.Subtitles != "" {
+			attributes = append(attributes, `SUBTITLES="`+variant.Subtitles+`"`)
+		}
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:%s\n%s\n", strings.Join(attributes, ","), variant.URI)
+	}
+	return &b
+}
+
+// ParseMasterPlaylist parses a master playlist written by this package.
+func ParseMasterPlaylist(r io.Reader) (*MasterPlaylist, error) {
+	playlist := &MasterPlaylist{}
+	scanner := bufio.NewScanner(r)
+
+	var pending *Variant
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		tag, value, _ := strings.Cut(line, ":")
+
+		switch {
+		case line == "":
+			continue
+		case lineNumber == 1 && line != "#EXTM3U":
+			return nil, fmt.Errorf("missing #EXTM3U header")
+		case tag == "#EXT-X-VERSION":
+			playlist.Version, _ = strconv.Atoi(value)
+		case tag == "#EXT-X-INDEPENDENT-SEGMENTS":
+			playlist.IndependentSegments = true
+		case tag == "#EXT-X-MEDIA":
+			attributes := ParseAttributes(value)
+			playlist.Media = append(playlist.Media, Media{
+				Type:       attributes["TYPE"],
+				GroupID:    attributes["GROUP-ID"],
+				Name:       attributes["NAME"],
+				Language:   attributes["LANGUAGE"],
+				Default:    attributes["DEFAULT"] == "YES",
+				AutoSelect: attributes["AUTOSELECT"] == "YES",
+				Channels:   attributes["CHANNELS"],
+				URI:        attributes["URI"],
+			})
+		case tag == "#EXT-X-STREAM-INF":
+			attributes := ParseAttributes(value)
+			pending = &Variant{
+				Audio:     attributes["AUDIO"],
+				Subtitles: attributes["SUBTITLES"],
+			}
+			pending.Bandwidth, _ = strconv.ParseInt(attributes["BANDWIDTH"], 10, 64)
+			pending.AverageBandwidth, _ = strconv.ParseInt(attributes["AVERAGE-BANDWIDTH"], 10, 64)
+			pending.FrameRate, _ = strconv.ParseFloat(attributes["FRAME-RATE"], 64)
+			if codecs := attributes["CODECS"]; codecs != "" {
+				pending.Codecs = strings.Split(codecs, ",")
+			}
+			if width, height, found := strings.Cut(attributes["RESOLUTION"], "x"); found {
+				pending.Width, _ = strconv.Atoi(width)
+				pending.Height, _ = strconv.Atoi(height)
+			}
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			if pending == nil {
+				return nil, fmt.Errorf("line %d: variant %s has no #EXT-X-STREAM-INF", lineNumber, line)
+			}
+			pending.URI = line
+			playlist.Variants = append(playlist.Variants, *pending)
+			pending = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return playlist, nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
@@ -0,0 +1,129 @@
+package m3u8
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// assertGolden compares got with testdata/name, -update rewrites the file.
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s does not match\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+var masterPlaylists = map[string]*MasterPlaylist{
+	// Video variants with a shared audio group, subtitles and an audio-only variant
+	"master_ts.m3u8": {
+		Version:             3,
+		IndependentSegments: true,
+		Media: []Media{
+			{Type: "AUDIO", GroupID: "audio", Name: "Audio", Default: true, AutoSelect: true, Channels: "2", URI: "audio/playlist.m3u8"},
+			{Type: "SUBTITLES", GroupID: "subs", Name: "English", Language: "en", Default: true, AutoSelect: true, URI: "subtitles/en.m3u8"},
+			{Type: "SUBTITLES", GroupID: "subs", Name: "Bahasa Indonesia", Language: "id", AutoSelect: true, URI: "subtitles/id.m3u8"},
+		},
+		Variants: []Variant{
+			{
+				URI:              "360p/playlist.m3u8",
+				Bandwidth:        1028000,
+				AverageBandwidth: 864000,
+				Codecs:           []string{"avc1.4d401e", "mp4a.40.2"},
+				Width:            640,
+				Height:           360,
+				FrameRate:        29.97,
+				Audio:            "audio",
+				Subtitles:        "subs",
+			},
+			{
+				URI:              "1080p/playlist.m3u8",
+				Bandwidth:        5128000,
+				AverageBandwidth: 4264000,
+				Codecs:           []string{"avc1.640028", "mp4a.40.2"},
+				Width:            1920,
+				Height:           1080,
+				FrameRate:        29.97,
+				Audio:            "audio",
+				Subtitles:        "subs",
+			},
+			{URI: "audio/playlist.m3u8", Bandwidth: 128000, AverageBandwidth: 96000, Codecs: []string{"mp4a.40.2"}},
+		},
+	},
+	// Video only fMP4 variants, optional attributes left out
+	"master_fmp4.m3u8": {
+		Version:             7,
+		IndependentSegments: true,
+		Variants: []Variant{
+			{URI: "720p/playlist.m3u8", Bandwidth: 1400000, AverageBandwidth: 1100000, Codecs: []string{"avc1.64001f"}, Width: 1280, Height: 720, FrameRate: 25},
+			{URI: "720p-hevc/playlist.m3u8", Bandwidth: 900000, Codecs: []string{"hvc1.1.6.L93.B0"}, Width: 1280, Height: 720, FrameRate: 25},
+			{URI: "720p-av1/playlist.m3u8", Bandwidth: 700000, Codecs: []string{"av01.0.05M.08"}, Width: 1280, Height: 720},
+		},
+	},
+}
+
+func TestMasterPlaylistWriteTo(t *testing.T) {
+	for name, playlist := range masterPlaylists {
+		t.Run(name, func(t *testing.T) {
+			var b bytes.Buffer
+			n, err := playlist.WriteTo(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(b.Len()) {
+				t.Errorf("WriteTo returned %d, wrote %d bytes", n, b.Len())
+			}
+			assertGolden(t, name, b.Bytes())
+
+			if !bytes.Equal(playlist.Bytes(), b.Bytes()) {
+				t.Error("Bytes differs from WriteTo")
+			}
+		})
+	}
+}
+
+func TestMasterPlaylistRoundTrip(t *testing.T) {
+	for name, playlist := range masterPlaylists {
+		t.Run(name, func(t *testing.T) {
+			parsed, err := ParseMasterPlaylist(bytes.NewReader(playlist.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parsed, playlist) {
+				t.Errorf("parsed playlist differs\ngot:  %+v\nwant: %+v", parsed, playlist)
+			}
+		})
+	}
+}
+
+func TestParseMasterPlaylistErrors(t *testing.T) {
+	tests := map[string]string{
+		"missing header":      "#EXT-X-VERSION:3\n",
+		"variant without inf": "#EXTM3U\n360p/playlist.m3u8\n",
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseMasterPlaylist(strings.NewReader(input)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+// Package m3u8 reads and writes the HLS playlists produced by the transcoder.
+package m3u8
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type Segment struct {
+	URI      string
+	Duration float64
+	// Key is set on the first segment an EXT-X-KEY applies to
+	Key *Key
+}
+
+// Key is an EXT-X-KEY tag, IV is a 0x prefixed hex string.
+type Key struct {
+	Method string
+	URI    string
+	IV     string
+}
+
+// MediaPlaylist is a parsed VOD media playlist.
+type MediaPlaylist struct {
+	Version        int
+	TargetDuration int
+	// InitURI is the EXT-X-MAP of fragmented MP4 playlists
+	InitURI  string
+	Segments []Segment
+}
+
+// Duration is the sum of all segment durations.
+func (p *MediaPlaylist) Duration() float64 {
+	var total float64
+	for _, segment := range p.Segments {
+		total += segment.Duration
+	}
+	return total
+}
+
+// WriteTo writes the playlist as a complete VOD playlist.
+func (p *MediaPlaylist) WriteTo(w io.Writer) (int64, error) {
+	return p.encode().WriteTo(w)
+}
+
+// Bytes returns the encoded playlist.
+func (p *MediaPlaylist) Bytes() []byte {
+	return p.encode().Bytes()
+}
+
+func (p *MediaPlaylist) encode() *bytes.Buffer {
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n")
+	if p.Version > 0 {
+		fmt.Fprintf(&b, "#EXT-X-VERSION:%d\n", p.Version)
+	}
+
+	targetDuration := p.TargetDuration
+	for _, segment := range p.Segments {
+		targetDuration = max(targetDuration, int(math.Ceil(segment.Duration)))
+	}
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", targetDuration)
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	if p.InitURI != "" {
+		fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"%s\"\n", p.InitURI)
+	}
+
+	for _, segment := range p.Segments {
+		if key := segment.Key; key != nil {
+			attributes := "METHOD=" + key.Method
+			if key.URI != "" {
+				attributes += `,URI="` + key.URI + `"`
+			}
+			if key.IV != "" {
+				attributes += ",IV=" + key.IV
+			}
+			fmt.Fprintf(&b, "#EXT-X-KEY:%s\n", attributes)
+		}
+		fmt.Fprintf(&b, "#EXTINF:%s,\n%s\n", strconv.FormatFloat(segment.Duration, 'f', 3, 64), segment.URI)
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return &b
+}
+
+// ParseMediaPlaylist parses the tags of a media playlist this package cares
+// about, unknown tags are skipped.
+func ParseMediaPlaylist(r io.Reader) (*MediaPlaylist, error) {
+	playlist := &MediaPlaylist{}
+	scanner := bufio.NewScanner(r)
+
+	var duration float64
+	var pendingSegment bool
+	var pendingKey *Key
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		tag, value, _ := strings.Cut(line, ":")
+
+		switch {
+		case line == "":
+			continue
+		case lineNumber == 1 && line != "#EXTM3U":
+			return nil, fmt.Errorf("missing #EXTM3U header")
+		case tag == "#EXT-X-VERSION":
+			playlist.Version, _ = strconv.Atoi(value)
+		case tag == "#EXT-X-TARGETDURATION":
+			playlist.TargetDuration, _ = strconv.Atoi(value)
+		case tag == "#EXT-X-MAP":
+			playlist.InitURI = ParseAttributes(value)["URI"]
+		case tag == "#EXT-X-KEY":
+			attributes := ParseAttributes(value)
+			pendingKey = &Key{Method: attributes["METHOD"], URI: attributes["URI"], IV: attributes["IV"]}
+		case tag == "#EXTINF":
+			durationValue, _, _ := strings.Cut(value, ",")
+			parsed, err := strconv.ParseFloat(durationValue, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid segment duration %q", lineNumber, durationValue)
+			}
+			duration, pendingSegment = parsed, true
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			if !pendingSegment {
+				return nil, fmt.Errorf("line %d: segment %s has no #EXTINF", lineNumber, line)
+			}
+			playlist.Segments = append(playlist.Segments, Segment{URI: line, Duration: duration, Key: pendingKey})
+			pendingSegment, pendingKey = false, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return playlist, nil
+}
+
+// ParseAttributes parses an attribute list like BANDWIDTH=800000,CODECS="avc1.4d401f,mp4a.40.2".
+func ParseAttributes(list string) map[string]string {
+	attributes := map[string]string{}
+	for list != "" {
+		name, rest, found := strings.Cut(list, "=")
+		if !found {
+			break
+		}
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+
+		attributes[strings.TrimSpace(name)] = value
+		list = strings.TrimPrefix(rest, ",")
+	}
+	return attributes
+}
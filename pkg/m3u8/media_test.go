@@ -0,0 +1,117 @@
+package m3u8
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var mediaPlaylists = map[string]*MediaPlaylist{
+	// Target duration is the longest segment rounded up
+	"media_ts.m3u8": {
+		Version:        3,
+		TargetDuration: 11,
+		Segments: []Segment{
+			{URI: "segment_000.ts", Duration: 10},
+			{URI: "segment_001.ts", Duration: 10.01},
+			{URI: "segment_002.ts", Duration: 4.5},
+		},
+	},
+	"media_fmp4.m3u8": {
+		Version:        7,
+		TargetDuration: 10,
+		InitURI:        "init.mp4",
+		Segments: []Segment{
+			{URI: "segment_000.m4s", Duration: 10},
+			{URI: "segment_001.m4s", Duration: 2.25},
+		},
+	},
+	// A key applies until the next one, the second rotates from segment 2
+	"media_encrypted.m3u8": {
+		Version:        3,
+		TargetDuration: 10,
+		Segments: []Segment{
+			{URI: "segment_000.ts", Duration: 10, Key: &Key{Method: "AES-128", URI: "https://example.com/api/keys/abc?key=0", IV: "0x00000000000000000000000000000000"}},
+			{URI: "segment_001.ts", Duration: 10},
+			{URI: "segment_002.ts", Duration: 6, Key: &Key{Method: "AES-128", URI: "https://example.com/api/keys/abc?key=1", IV: "0x00000000000000000000000000000002"}},
+		},
+	},
+}
+
+func TestMediaPlaylistWriteTo(t *testing.T) {
+	for name, playlist := range mediaPlaylists {
+		t.Run(name, func(t *testing.T) {
+			var b bytes.Buffer
+			n, err := playlist.WriteTo(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(b.Len()) {
+				t.Errorf("WriteTo returned %d, wrote %d bytes", n, b.Len())
+			}
+			assertGolden(t, name, b.Bytes())
+
+			if !bytes.Equal(playlist.Bytes(), b.Bytes()) {
+				t.Error("Bytes differs from WriteTo")
+			}
+		})
+	}
+}
+
+func TestMediaPlaylistRoundTrip(t *testing.T) {
+	for name, playlist := range mediaPlaylists {
+		t.Run(name, func(t *testing.T) {
+			parsed, err := ParseMediaPlaylist(bytes.NewReader(playlist.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parsed, playlist) {
+				t.Errorf("parsed playlist differs\ngot:  %+v\nwant: %+v", parsed, playlist)
+			}
+		})
+	}
+}
+
+func TestMediaPlaylistTargetDuration(t *testing.T) {
+	playlist := MediaPlaylist{Segments: []Segment{{URI: "a.ts", Duration: 6.2}, {URI: "b.ts", Duration: 3}}}
+
+	parsed, err := ParseMediaPlaylist(bytes.NewReader(playlist.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.TargetDuration != 7 {
+		t.Errorf("TargetDuration = %d, want 7", parsed.TargetDuration)
+	}
+	if got := parsed.Duration(); got != 9.2 {
+		t.Errorf("Duration = %v, want 9.2", got)
+	}
+}
+
+func TestParseMediaPlaylistErrors(t *testing.T) {
+	tests := map[string]string{
+		"missing header":           "#EXTINF:10.000,\nsegment_000.ts\n",
+		"segment without extinf":   "#EXTM3U\nsegment_000.ts\n",
+		"invalid segment duration": "#EXTM3U\n#EXTINF:ten,\nsegment_000.ts\n",
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseMediaPlaylist(strings.NewReader(input)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	got := ParseAttributes(`BANDWIDTH=800000,CODECS="avc1.4d401f,mp4a.40.2",RESOLUTION=640x360,AUDIO="audio"`)
+	want := map[string]string{
+		"BANDWIDTH":  "800000",
+		"CODECS":     "avc1.4d401f,mp4a.40.2",
+		"RESOLUTION": "640x360",
+		"AUDIO":      "audio",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseAttributes = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testStorageContract checks the behaviour every StorageService promises.
+// All objects are written below prefix, which must not hold any yet, and are
+// removed again at the end.
+func testStorageContract(t *testing.T, s StorageService, prefix string) {
+	t.Cleanup(func() {
+		if err := s.DeletePrefix(prefix); err != nil {
+			t.Errorf("failed to clean up %s: %v", prefix, err)
+		}
+	})
+
+	upload := func(t *testing.T, key, content string, size int64) {
+		t.Helper()
+		if err := s.UploadObject(prefix+key, strings.NewReader(content), size, UploadOptions{}); err != nil {
+			t.Fatalf("UploadObject(%s): %v", key, err)
+		}
+	}
+	read := func(t *testing.T, key string) string {
+		t.Helper()
+		reader, err := s.GetObject(prefix + key)
+		if err != nil {
+			t.Fatalf("GetObject(%s): %v", key, err)
+		}
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("GetObject(%s): %v", key, err)
+		}
+		return string(data)
+	}
+	list := func(t *testing.T, listPrefix string) []string {
+		t.Helper()
+		objects, err := s.ListObjects(prefix + listPrefix)
+		if err != nil {
+			t.Fatalf("ListObjects(%s): %v", listPrefix, err)
+		}
+		keys := make([]string, 0, len(objects))
+		for _, object := range objects {
+			keys = append(keys, strings.TrimPrefix(object.Key, prefix))
+		}
+		slices.Sort(keys)
+		return keys
+	}
+
+	t.Run("upload and get", func(t *testing.T) {
+		upload(t, "videos/a/master.m3u8", "#EXTM3U\n", 8)
+		if got := read(t, "videos/a/master.m3u8"); got != "#EXTM3U\n" {
+			t.Errorf("got %q", got)
+		}
+
+		// Uploading again replaces the object
+		upload(t, "videos/a/master.m3u8", "#EXTM3U\n#EXT-X-VERSION:3\n", 24)
+		if got := read(t, "videos/a/master.m3u8"); got != "#EXTM3U\n#EXT-X-VERSION:3\n" {
+			t.Errorf("got %q after replacing", got)
+		}
+	})
+
+	t.Run("upload of unknown size", func(t *testing.T) {
+		content := strings.Repeat("segment", 1024)
+		upload(t, "videos/a/480p/segment000.ts", content, -1)
+		if got := read(t, "videos/a/480p/segment000.ts"); got != content {
+			t.Errorf("got %d bytes, want %d", len(got), len(content))
+		}
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		upload(t, "videos/a/thumbnails.vtt", "WEBVTT\n", 7)
+		info, err := s.StatObject(prefix + "videos/a/thumbnails.vtt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Key != prefix+"videos/a/thumbnails.vtt" || info.Size != 7 {
+			t.Errorf("info = %+v", info)
+		}
+		if info.ContentType != "text/vtt" {
+			t.Errorf("content type = %q, want text/vtt", info.ContentType)
+		}
+	})
+
+	t.Run("missing objects", func(t *testing.T) {
+		if _, err := s.GetObject(prefix + "videos/missing"); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("GetObject error = %v, want ErrObjectNotFound", err)
+		}
+		if _, err := s.StatObject(prefix + "videos/missing"); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("StatObject error = %v, want ErrObjectNotFound", err)
+		}
+		// Providers may treat deleting nothing as done
+		if err := s.DeleteObject(prefix + "videos/missing"); err != nil && !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("DeleteObject error = %v", err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		upload(t, "list/b/1.ts", "1", 1)
+		upload(t, "list/b/sub/2.ts", "2", 1)
+		upload(t, "list/bc/3.ts", "3", 1)
+
+		if got, want := list(t, "list/b/"), []string{"list/b/1.ts", "list/b/sub/2.ts"}; !slices.Equal(got, want) {
+			t.Errorf("ListObjects(list/b/) = %v, want %v", got, want)
+		}
+		// Prefixes match keys, not directories
+		if got, want := list(t, "list/b"), []string{"list/b/1.ts", "list/b/sub/2.ts", "list/bc/3.ts"}; !slices.Equal(got, want) {
+			t.Errorf("ListObjects(list/b) = %v, want %v", got, want)
+		}
+		if got := list(t, "list/none/"); len(got) != 0 {
+			t.Errorf("ListObjects(list/none/) = %v", got)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		upload(t, "delete/one.ts", "1", 1)
+		upload(t, "delete/two.ts", "2", 1)
+
+		if err := s.DeleteObject(prefix + "delete/one.ts"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetObject(prefix + "delete/one.ts"); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("deleted object is still there: %v", err)
+		}
+		if got := read(t, "delete/two.ts"); got != "2" {
+			t.Errorf("other object = %q", got)
+		}
+	})
+
+	t.Run("delete prefix", func(t *testing.T) {
+		upload(t, "prefix/v1/master.m3u8", "m", 1)
+		upload(t, "prefix/v1/480p/segment000.ts", "s", 1)
+		upload(t, "prefix/v10/master.m3u8", "m", 1)
+
+		if err := s.DeletePrefix(prefix + "prefix/v1/"); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := list(t, "prefix/"), []string{"prefix/v10/master.m3u8"}; !slices.Equal(got, want) {
+			t.Errorf("left %v, want %v", got, want)
+		}
+		// Nothing left to delete is not an error
+		if err := s.DeletePrefix(prefix + "prefix/v1/"); err != nil {
+			t.Errorf("DeletePrefix of an empty prefix: %v", err)
+		}
+	})
+
+	t.Run("presigned get", func(t *testing.T) {
+		upload(t, "presign/poster.jpg", "jpeg data", 9)
+
+		url, err := s.PresignGetObject(prefix+"presign/poster.jpg", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		if response.StatusCode != http.StatusOK || string(body) != "jpeg data" {
+			t.Errorf("GET %s = %d %q", url, response.StatusCode, body)
+		}
+	})
+
+	t.Run("presigned put", func(t *testing.T) {
+		url, err := s.PresignPutObject(prefix+"presign/upload.bin", time.Minute)
+		if errors.Is(err, ErrNotSupported) {
+			t.Skip("provider does not presign uploads")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		request, err := http.NewRequest(http.MethodPut, url, bytes.NewReader([]byte("uploaded")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode/100 != 2 {
+			t.Fatalf("PUT %s = %d", url, response.StatusCode)
+		}
+		if got := read(t, "presign/upload.bin"); got != "uploaded" {
+			t.Errorf("got %q", got)
+		}
+	})
+}
@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LocalService stores objects as plain files under Root. It is meant for
+// development and tests, the files are served back by the Gin router.
+type LocalService struct {
+	Root string
+	// BaseURL is where the router serves Root
+	BaseURL string
+}
+
+func NewLocalService(root, baseURL string) (*LocalService, error) {
+	if root == "" {
+		return nil, fmt.Errorf("missing local storage root directory")
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve local storage root %s: %w", root, err)
+	}
+	if err := os.MkdirAll(absRoot, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create local storage root %s: %w", absRoot, err)
+	}
+
+	return &LocalService{Root: absRoot, BaseURL: baseURL}, nil
+}
+
+func (l *LocalService) UploadObject(objectName string, reader io.Reader, size int64, opts UploadOptions) error {
+	return l.writeObject(objectName, reader)
+}
+
+func (l *LocalService) GetObject(objectName string) (io.ReadCloser, error) {
+	path, err := l.objectPath(objectName)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, l.wrapError(objectName, err)
+	}
+	return file, nil
+}
+
+func (l *LocalService) StatObject(objectName string) (ObjectInfo, error) {
+	path, err := l.objectPath(objectName)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return ObjectInfo{}, l.wrapError(objectName, err)
+	}
+	if info.IsDir() {
+		return ObjectInfo{}, fmt.Errorf("%s: %w", objectName, ErrObjectNotFound)
+	}
+	return localObjectInfo(objectName, info), nil
+}
+
+func (l *LocalService) ListObjects(prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := l.walkPrefix(prefix, func(key string, info fs.FileInfo) error {
+		objects = append(objects, localObjectInfo(key, info))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects with prefix %s: %w", prefix, err)
+	}
+	return objects, nil
+}
+
+func (l *LocalService) DeleteObject(objectName string) error {
+	path, err := l.objectPath(objectName)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return l.wrapError(objectName, err)
+	}
+	l.pruneEmptyDirs(filepath.Dir(path))
+	return nil
+}
+
+func (l *LocalService) DeletePrefix(prefix string) error {
+	var keys []string
+	err := l.walkPrefix(prefix, func(key string, info fs.FileInfo) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list objects with prefix %s: %w", prefix, err)
+	}
+
+	for _, key := range keys {
+		if err := l.DeleteObject(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PresignGetObject returns the public URL, local files are served without signatures.
+func (l *LocalService) PresignGetObject(objectName string, expiry time.Duration) (string, error) {
+	if _, err := l.objectPath(objectName); err != nil {
+		return "", err
+	}
+	return l.BaseURL + objectName, nil
+}
+
+func (l *LocalService) PresignPutObject(objectName string, expiry time.Duration) (string, error) {
+	return "", fmt.Errorf("failed to presign PUT %s: %w", objectName, ErrNotSupported)
+}
+
+// writeObject writes to a temporary file first so readers never see a partial object.
+func (l *LocalService) writeObject(objectName string, src io.Reader) error {
+	path, err := l.objectPath(objectName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", objectName, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", objectName, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write object %s: %w", objectName, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write object %s: %w", objectName, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write object %s: %w", objectName, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write object %s: %w", objectName, err)
+	}
+
+	log.Printf("Successfully stored object %s in %s", objectName, l.Root)
+	return nil
+}
+
+// walkPrefix calls fn for every stored object whose key starts with prefix.
+func (l *LocalService) walkPrefix(prefix string, fn func(key string, info fs.FileInfo) error) error {
+	// Start from the deepest directory the prefix names, the rest is matched on the key
+	dir := l.Root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		path, err := l.objectPath(prefix[:i])
+		if err != nil {
+			return err
+		}
+		dir = path
+	}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.Root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(key, info)
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// objectPath maps an object name to a file path, rejecting names that escape Root.
+func (l *LocalService) objectPath(objectName string) (string, error) {
+	path := filepath.Join(l.Root, filepath.FromSlash(objectName))
+	if path != l.Root && !strings.HasPrefix(path, l.Root+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid object name %s", objectName)
+	}
+	return path, nil
+}
+
+func (l *LocalService) pruneEmptyDirs(dir string) {
+	for dir != l.Root && strings.HasPrefix(dir, l.Root) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func (l *LocalService) wrapError(objectName string, err error) error {
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s: %w", objectName, ErrObjectNotFound)
+	}
+	return fmt.Errorf("object %s: %w", objectName, err)
+}
+
+func localObjectInfo(key string, info fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  ContentTypeFor(key),
+		ETag:         fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()),
+		LastModified: info.ModTime(),
+	}
+}
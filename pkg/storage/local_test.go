@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestLocalService stores objects in a temporary directory served the way
+// the router serves LOCAL_STORAGE_ROOT.
+func newTestLocalService(t *testing.T) *LocalService {
+	t.Helper()
+
+	root := t.TempDir()
+	mux := http.NewServeMux()
+	mux.Handle("/storage/", http.StripPrefix("/storage/", http.FileServer(http.Dir(root))))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	local, err := NewLocalService(root, server.URL+"/storage/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return local
+}
+
+func TestLocalServiceContract(t *testing.T) {
+	testStorageContract(t, newTestLocalService(t), "")
+}
+
+func TestLocalServiceRejectsEscapingNames(t *testing.T) {
+	local := newTestLocalService(t)
+
+	for _, name := range []string{"../outside.ts", "videos/../../outside.ts"} {
+		if err := local.UploadObject(name, strings.NewReader("x"), 1, UploadOptions{}); err == nil {
+			t.Errorf("UploadObject(%s) should fail", name)
+		}
+		if _, err := local.GetObject(name); err == nil {
+			t.Errorf("GetObject(%s) should fail", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(local.Root), "outside.ts")); !os.IsNotExist(err) {
+		t.Errorf("object was written outside the root: %v", err)
+	}
+}
+
+func TestLocalServiceHidesPartialUploads(t *testing.T) {
+	local := newTestLocalService(t)
+
+	// What writeObject leaves behind while an upload is in progress
+	dir := filepath.Join(local.Root, "videos", "a")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".upload-123"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := local.ListObjects("videos/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("ListObjects = %+v, want no objects", objects)
+	}
+}
+
+func TestLocalServicePrunesEmptyDirectories(t *testing.T) {
+	local := newTestLocalService(t)
+
+	if err := local.UploadObject("videos/a/480p/segment000.ts", strings.NewReader("x"), 1, UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.DeletePrefix("videos/a/"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(local.Root, "videos")); !os.IsNotExist(err) {
+		t.Errorf("empty directories were left behind: %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+package storage
+
+import "time"
+
+// MultipartUploader is implemented by providers that let clients upload
+// parts of an object straight to the bucket through presigned URLs.
+type MultipartUploader interface {
+	// CreateMultipartUpload starts a multipart upload and returns its ID.
+	CreateMultipartUpload(objectName, contentType string) (string, error)
+	// PresignUploadPart returns a URL that accepts an HTTP PUT of a part,
+	// part numbers start at 1.
+	PresignUploadPart(objectName, uploadID string, partNumber int, expiry time.Duration) (string, error)
+	// CompleteMultipartUpload assembles parts 1..totalParts into objectName.
+	CompleteMultipartUpload(objectName, uploadID string, totalParts int) error
+	AbortMultipartUpload(objectName, uploadID string) error
+}
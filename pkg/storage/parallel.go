@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileUpload is a local file stored as ObjectName.
+type FileUpload struct {
+	ObjectName string
+	Path       string
+}
+
+// ParallelUploader uploads files with at most Concurrency uploads in flight
+// and tries every file up to Attempts times.
+type ParallelUploader struct {
+	Storage     StorageService
+	Concurrency int
+	Attempts    int
+	// RetryDelay is doubled after every failed attempt of a file
+	RetryDelay time.Duration
+}
+
+func NewParallelUploader(s StorageService, concurrency, attempts int) *ParallelUploader {
+	return &ParallelUploader{
+		Storage:     s,
+		Concurrency: max(concurrency, 1),
+		Attempts:    max(attempts, 1),
+		RetryDelay:  500 * time.Millisecond,
+	}
+}
+
+// Upload returns once every file is stored. The first file that fails all
+// its attempts stops the remaining uploads and its error is returned.
+func (u *ParallelUploader) Upload(ctx context.Context, files []FileUpload) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		queue    = make(chan FileUpload)
+	)
+
+	for i := 0; i < min(u.Concurrency, len(files)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range queue {
+				if err := u.uploadWithRetry(ctx, file); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+send:
+	for _, file := range files {
+		select {
+		case queue <- file:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+func (u *ParallelUploader) uploadWithRetry(ctx context.Context, file FileUpload) error {
+	delay := u.RetryDelay
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := UploadFile(u.Storage, file.ObjectName, file.Path)
+		if err == nil {
+			return nil
+		}
+		// A missing local file will still be missing on the next attempt
+		if errors.Is(err, os.ErrNotExist) || attempt >= u.Attempts {
+			return fmt.Errorf("failed to upload %s after %d attempts: %w", file.ObjectName, attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
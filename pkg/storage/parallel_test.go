@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingStorage counts the uploads in flight and fails the first
+// failures[name] uploads of an object.
+type recordingStorage struct {
+	*LocalService
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	failures map[string]int
+	attempts map[string]int
+	stored   []string
+}
+
+func newRecordingStorage(t *testing.T, failures map[string]int) *recordingStorage {
+	return &recordingStorage{LocalService: newTestLocalService(t), failures: failures, attempts: map[string]int{}}
+}
+
+func (s *recordingStorage) UploadObject(objectName string, reader io.Reader, size int64, opts UploadOptions) error {
+	s.mu.Lock()
+	s.inFlight++
+	s.peak = max(s.peak, s.inFlight)
+	s.attempts[objectName]++
+	fail := s.failures[objectName] > 0
+	if fail {
+		s.failures[objectName]--
+	}
+	s.mu.Unlock()
+
+	// Long enough for the other workers to start their uploads
+	time.Sleep(5 * time.Millisecond)
+
+	err := errors.New("connection reset by peer")
+	if !fail {
+		err = s.LocalService.UploadObject(objectName, reader, size, opts)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	if err == nil {
+		s.stored = append(s.stored, objectName)
+	}
+	return err
+}
+
+func writeTestFiles(t *testing.T, count int) []FileUpload {
+	t.Helper()
+	dir := t.TempDir()
+	files := make([]FileUpload, count)
+	for i := range files {
+		path := filepath.Join(dir, fmt.Sprintf("segment%03d.ts", i))
+		if err := os.WriteFile(path, []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files[i] = FileUpload{ObjectName: "videos/a/480p/" + filepath.Base(path), Path: path}
+	}
+	return files
+}
+
+func TestParallelUploaderBoundsConcurrency(t *testing.T) {
+	s := newRecordingStorage(t, nil)
+	files := writeTestFiles(t, 20)
+
+	if err := NewParallelUploader(s, 4, 1).Upload(context.Background(), files); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.stored) != len(files) {
+		t.Errorf("stored %d files, want %d", len(s.stored), len(files))
+	}
+	if s.peak > 4 {
+		t.Errorf("%d uploads ran at once, want at most 4", s.peak)
+	}
+	if s.peak < 2 {
+		t.Errorf("uploads ran one at a time")
+	}
+}
+
+func TestParallelUploaderRetriesFailedUploads(t *testing.T) {
+	files := writeTestFiles(t, 3)
+	s := newRecordingStorage(t, map[string]int{files[1].ObjectName: 2})
+	uploader := NewParallelUploader(s, 2, 3)
+	uploader.RetryDelay = time.Millisecond
+
+	if err := uploader.Upload(context.Background(), files); err != nil {
+		t.Fatal(err)
+	}
+	if s.attempts[files[1].ObjectName] != 3 || s.attempts[files[0].ObjectName] != 1 {
+		t.Errorf("attempts = %v", s.attempts)
+	}
+	if _, err := s.StatObject(files[1].ObjectName); err != nil {
+		t.Errorf("retried file was not stored: %v", err)
+	}
+}
+
+func TestParallelUploaderGivesUp(t *testing.T) {
+	files := writeTestFiles(t, 10)
+	s := newRecordingStorage(t, map[string]int{files[0].ObjectName: 5})
+	uploader := NewParallelUploader(s, 1, 2)
+	uploader.RetryDelay = time.Millisecond
+
+	err := uploader.Upload(context.Background(), files)
+	if err == nil {
+		t.Fatal("upload should fail after 2 attempts")
+	}
+	if s.attempts[files[0].ObjectName] != 2 {
+		t.Errorf("attempts = %d, want 2", s.attempts[files[0].ObjectName])
+	}
+	// The failure stops the files that were not started yet
+	if len(s.stored) != 0 {
+		t.Errorf("kept uploading after the failure: %v", s.stored)
+	}
+}
+
+func TestParallelUploaderDoesNotRetryMissingFiles(t *testing.T) {
+	s := newRecordingStorage(t, nil)
+	uploader := NewParallelUploader(s, 2, 3)
+	uploader.RetryDelay = time.Millisecond
+
+	missing := FileUpload{ObjectName: "videos/a/480p/segment000.ts", Path: filepath.Join(t.TempDir(), "missing.ts")}
+	err := uploader.Upload(context.Background(), []FileUpload{missing})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("error = %v, want a missing file", err)
+	}
+	if len(s.attempts) != 0 {
+		t.Errorf("attempts = %v", s.attempts)
+	}
+}
@@ -2,10 +2,12 @@ package storage
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"log"
-	"mime"
-	"os"
-	"path/filepath"
+	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/minio/minio-go/v7"
@@ -51,14 +53,174 @@ func NewS3Service(endpoint, accessKey, secretKey, bucket string, isHTTPS bool) (
 	}, nil
 }
 
-func (m *S3Service) UploadObject(objectName string, file *os.File) error {
-	ext := filepath.Ext(objectName)
-	contentType := mime.TypeByExtension(ext)
-
-	_, err := m.Client.FPutObject(context.Background(), m.Bucket, objectName, file.Name(), minio.PutObjectOptions{ContentType: contentType})
+func (m *S3Service) UploadObject(objectName string, reader io.Reader, size int64, opts UploadOptions) error {
+	_, err := m.Client.PutObject(context.Background(), m.Bucket, objectName, reader, size, minio.PutObjectOptions{
+		ContentType:  opts.contentType(objectName),
+		UserMetadata: opts.Metadata,
+	})
 	if err != nil {
 		log.Printf("Failed to upload object %s: %v", objectName, err)
 		return err
 	}
 	return nil
 }
+
+func (m *S3Service) GetObject(objectName string) (io.ReadCloser, error) {
+	obj, err := m.Client.GetObject(context.Background(), m.Bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, m.wrapError(objectName, err)
+	}
+
+	// GetObject is lazy, stat it so a missing object fails here instead of on first read
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, m.wrapError(objectName, err)
+	}
+	return obj, nil
+}
+
+func (m *S3Service) StatObject(objectName string) (ObjectInfo, error) {
+	info, err := m.Client.StatObject(context.Background(), m.Bucket, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, m.wrapError(objectName, err)
+	}
+	return s3ObjectInfo(info), nil
+}
+
+func (m *S3Service) ListObjects(prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for info := range m.Client.ListObjects(context.Background(), m.Bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if info.Err != nil {
+			return nil, fmt.Errorf("failed to list objects with prefix %s: %w", prefix, info.Err)
+		}
+		objects = append(objects, s3ObjectInfo(info))
+	}
+	return objects, nil
+}
+
+func (m *S3Service) DeleteObject(objectName string) error {
+	err := m.Client.RemoveObject(context.Background(), m.Bucket, objectName, minio.RemoveObjectOptions{})
+	if err != nil {
+		return m.wrapError(objectName, err)
+	}
+	return nil
+}
+
+func (m *S3Service) DeletePrefix(prefix string) error {
+	ctx := context.Background()
+	objectsCh := m.Client.ListObjects(ctx, m.Bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+
+	for removeErr := range m.Client.RemoveObjects(ctx, m.Bucket, objectsCh, minio.RemoveObjectsOptions{}) {
+		if removeErr.Err != nil {
+			return fmt.Errorf("failed to delete object %s: %w", removeErr.ObjectName, removeErr.Err)
+		}
+	}
+	return nil
+}
+
+func (m *S3Service) PresignGetObject(objectName string, expiry time.Duration) (string, error) {
+	u, err := m.Client.PresignedGetObject(context.Background(), m.Bucket, objectName, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign GET %s: %w", objectName, err)
+	}
+	return u.String(), nil
+}
+
+func (m *S3Service) PresignPutObject(objectName string, expiry time.Duration) (string, error) {
+	u, err := m.Client.PresignedPutObject(context.Background(), m.Bucket, objectName, expiry)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign PUT %s: %w", objectName, err)
+	}
+	return u.String(), nil
+}
+
+func (m *S3Service) wrapError(objectName string, err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("%s: %w", objectName, ErrObjectNotFound)
+	}
+	return fmt.Errorf("object %s: %w", objectName, err)
+}
+
+func s3ObjectInfo(info minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+	}
+}
+
+func (m *S3Service) CreateMultipartUpload(objectName, contentType string) (string, error) {
+	core := minio.Core{Client: m.Client}
+	uploadID, err := core.NewMultipartUpload(context.Background(), m.Bucket, objectName, minio.PutObjectOptions{
+		ContentType: UploadOptions{ContentType: contentType}.contentType(objectName),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create multipart upload for %s: %w", objectName, err)
+	}
+	return uploadID, nil
+}
+
+func (m *S3Service) PresignUploadPart(objectName, uploadID string, partNumber int, expiry time.Duration) (string, error) {
+	params := url.Values{}
+	params.Set("partNumber", strconv.Itoa(partNumber))
+	params.Set("uploadId", uploadID)
+
+	u, err := m.Client.Presign(context.Background(), http.MethodPut, m.Bucket, objectName, expiry, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign part %d of %s: %w", partNumber, objectName, err)
+	}
+	return u.String(), nil
+}
+
+// CompleteMultipartUpload lists the parts from S3 instead of trusting client ETags.
+func (m *S3Service) CompleteMultipartUpload(objectName, uploadID string, totalParts int) error {
+	ctx := context.Background()
+	core := minio.Core{Client: m.Client}
+
+	var parts []minio.CompletePart
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(ctx, m.Bucket, objectName, uploadID, marker, 1000)
+		if err != nil {
+			return fmt.Errorf("failed to list parts of %s: %w", objectName, err)
+		}
+		for _, part := range result.ObjectParts {
+			parts = append(parts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+		}
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+
+	if len(parts) != totalParts {
+		return fmt.Errorf("multipart upload of %s has %d of %d parts", objectName, len(parts), totalParts)
+	}
+	for i, part := range parts {
+		if part.PartNumber != i+1 {
+			return fmt.Errorf("multipart upload of %s is missing part %d", objectName, i+1)
+		}
+	}
+
+	_, err := core.CompleteMultipartUpload(ctx, m.Bucket, objectName, uploadID, parts, minio.PutObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload of %s: %w", objectName, err)
+	}
+	return nil
+}
+
+func (m *S3Service) AbortMultipartUpload(objectName, uploadID string) error {
+	core := minio.Core{Client: m.Client}
+	if err := core.AbortMultipartUpload(context.Background(), m.Bucket, objectName, uploadID); err != nil {
+		return fmt.Errorf("failed to abort multipart upload of %s: %w", objectName, err)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestS3ServiceContract runs against a real bucket, e.g. a local MinIO, when
+// TEST_S3_ENDPOINT is set.
+func TestS3ServiceContract(t *testing.T) {
+	endpoint := os.Getenv("TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("TEST_S3_ENDPOINT is not set")
+	}
+
+	s3, err := NewS3Service(endpoint, os.Getenv("TEST_S3_ACCESS_KEY"), os.Getenv("TEST_S3_SECRET_KEY"),
+		os.Getenv("TEST_S3_BUCKET_NAME"), os.Getenv("TEST_S3_IS_HTTPS") == "true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorageContract(t, s3, fmt.Sprintf("contract-test/%d/", time.Now().UnixNano()))
+}
@@ -13,21 +13,29 @@ type S3Cfg struct {
 }
 
 type SwiftCfg struct {
-	SWIFT_USERNAME  string
-	SWIFT_API_KEY   string
-	SWIFT_AUTH_URL  string
-	SWIFT_REGION    string
-	SWIFT_CONTAINER string
+	SWIFT_USERNAME     string
+	SWIFT_API_KEY      string
+	SWIFT_AUTH_URL     string
+	SWIFT_REGION       string
+	SWIFT_CONTAINER    string
+	SWIFT_TEMP_URL_KEY string
 }
 
-func NewStorageService(provider string, s3Cfg S3Cfg, swiftCfg SwiftCfg) (StorageService, error) {
+type LocalCfg struct {
+	LOCAL_STORAGE_ROOT string
+	LOCAL_STORAGE_URL  string
+}
+
+func NewStorageService(provider string, s3Cfg S3Cfg, swiftCfg SwiftCfg, localCfg LocalCfg) (StorageService, error) {
 	switch provider {
 	case "s3":
 		return NewS3Service(
 			s3Cfg.S3_ENDPOINT, s3Cfg.S3_ACCESS_KEY, s3Cfg.S3_SECRET_KEY, s3Cfg.S3_BUCKET_NAME, s3Cfg.S3_IS_HTTPS,
 		)
 	case "swift":
-		return NewSwiftService(swiftCfg.SWIFT_USERNAME, swiftCfg.SWIFT_API_KEY, swiftCfg.SWIFT_AUTH_URL, swiftCfg.SWIFT_REGION, swiftCfg.SWIFT_CONTAINER)
+		return NewSwiftService(swiftCfg.SWIFT_USERNAME, swiftCfg.SWIFT_API_KEY, swiftCfg.SWIFT_AUTH_URL, swiftCfg.SWIFT_REGION, swiftCfg.SWIFT_CONTAINER, swiftCfg.SWIFT_TEMP_URL_KEY)
+	case "local":
+		return NewLocalService(localCfg.LOCAL_STORAGE_ROOT, localCfg.LOCAL_STORAGE_URL)
 	default:
 		return nil, errors.New("unsupported storage provider")
 	}
@@ -1,7 +1,45 @@
 package storage
 
-import "os"
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrObjectNotFound is returned when the requested object does not exist.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ErrNotSupported is returned when a provider cannot perform an operation.
+var ErrNotSupported = errors.New("operation not supported by storage provider")
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+type UploadOptions struct {
+	// ContentType defaults to the type guessed from the object extension
+	ContentType string
+	Metadata    map[string]string
+}
 
 type StorageService interface {
-	UploadObject(objectName string, file *os.File) error
+	// UploadObject streams reader into objectName. Pass size -1 when the
+	// length is unknown, providers then fall back to chunked transfer.
+	UploadObject(objectName string, reader io.Reader, size int64, opts UploadOptions) error
+	// GetObject opens the object for reading, the caller must close it.
+	GetObject(objectName string) (io.ReadCloser, error)
+	StatObject(objectName string) (ObjectInfo, error)
+	// ListObjects returns every object whose name starts with prefix.
+	ListObjects(prefix string) ([]ObjectInfo, error)
+	DeleteObject(objectName string) error
+	// DeletePrefix removes every object whose name starts with prefix.
+	DeletePrefix(prefix string) error
+	// PresignGetObject returns a URL that downloads objectName until expiry passes.
+	PresignGetObject(objectName string, expiry time.Duration) (string, error)
+	// PresignPutObject returns a URL that accepts an HTTP PUT of objectName until expiry passes.
+	PresignPutObject(objectName string, expiry time.Duration) (string, error)
 }
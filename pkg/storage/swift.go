@@ -1,12 +1,17 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
-	"mime"
-	"os"
-	"path/filepath"
+	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/ncw/swift/v2"
@@ -19,9 +24,11 @@ type SwiftService struct {
 	AuthURL   string
 	Region    string
 	Container string
+	// TempURLKey is the account temp URL key used to sign presigned URLs
+	TempURLKey string
 }
 
-func NewSwiftService(username, apiKey, authURL, region, containerName string) (*SwiftService, error) {
+func NewSwiftService(username, apiKey, authURL, region, containerName, tempURLKey string) (*SwiftService, error) {
 	// Input validation
 	if username == "" || apiKey == "" || authURL == "" || region == "" {
 		return nil, fmt.Errorf("missing required authentication parameters")
@@ -68,32 +75,32 @@ func NewSwiftService(username, apiKey, authURL, region, containerName string) (*
 	}
 
 	return &SwiftService{
-		Client:    client,
-		Username:  username,
-		ApiKey:    apiKey,
-		AuthURL:   authURL,
-		Region:    region,
-		Container: containerName,
+		Client:     client,
+		Username:   username,
+		ApiKey:     apiKey,
+		AuthURL:    authURL,
+		Region:     region,
+		Container:  containerName,
+		TempURLKey: tempURLKey,
 	}, nil
 }
 
-func (r *SwiftService) UploadObject(objectName string, file *os.File) error {
-	ext := filepath.Ext(objectName)
-	contentType := mime.TypeByExtension(ext)
-	if contentType == "" {
-		contentType = "application/octet-stream"
+func (r *SwiftService) UploadObject(objectName string, reader io.Reader, size int64, opts UploadOptions) error {
+	headers := swift.Headers{
+		"X-Object-Meta-Uploaded-By": r.Username,
+		"X-Object-Meta-Upload-Date": time.Now().UTC().Format(time.RFC3339),
+	}
+	for key, value := range opts.Metadata {
+		headers["X-Object-Meta-"+key] = value
 	}
 
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
-	// Upload object
-	_, err := r.Client.ObjectPut(ctx, r.Container, objectName, file, false,
-		"", contentType, swift.Headers{
-			"X-Object-Meta-Uploaded-By": r.Username,
-			"X-Object-Meta-Upload-Date": time.Now().UTC().Format(time.RFC3339),
-		})
+	// Upload object, without a Content-Length header the body is sent with chunked transfer
+	_, err := r.Client.ObjectPut(ctx, r.Container, objectName, reader, false,
+		"", opts.contentType(objectName), headers)
 	if err != nil {
 		return fmt.Errorf("failed to upload object %s to %s: %w", objectName, r.Container, err)
 	}
@@ -101,3 +108,169 @@ func (r *SwiftService) UploadObject(objectName string, file *os.File) error {
 	log.Printf("Successfully uploaded object %s to container %s", objectName, r.Container)
 	return nil
 }
+
+func (r *SwiftService) GetObject(objectName string) (io.ReadCloser, error) {
+	file, _, err := r.Client.ObjectOpen(context.Background(), r.Container, objectName, false, nil)
+	if err != nil {
+		return nil, r.wrapError(objectName, err)
+	}
+	return file, nil
+}
+
+func (r *SwiftService) StatObject(objectName string) (ObjectInfo, error) {
+	info, _, err := r.Client.Object(context.Background(), r.Container, objectName)
+	if err != nil {
+		return ObjectInfo{}, r.wrapError(objectName, err)
+	}
+	return swiftObjectInfo(info), nil
+}
+
+func (r *SwiftService) ListObjects(prefix string) ([]ObjectInfo, error) {
+	objects, err := r.Client.ObjectsAll(context.Background(), r.Container, &swift.ObjectsOpts{Prefix: prefix})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects with prefix %s in %s: %w", prefix, r.Container, err)
+	}
+
+	infos := make([]ObjectInfo, 0, len(objects))
+	for _, object := range objects {
+		infos = append(infos, swiftObjectInfo(object))
+	}
+	return infos, nil
+}
+
+func (r *SwiftService) DeleteObject(objectName string) error {
+	err := r.Client.ObjectDelete(context.Background(), r.Container, objectName)
+	if err != nil {
+		return r.wrapError(objectName, err)
+	}
+	return nil
+}
+
+func (r *SwiftService) DeletePrefix(prefix string) error {
+	ctx := context.Background()
+	names, err := r.Client.ObjectNamesAll(ctx, r.Container, &swift.ObjectsOpts{Prefix: prefix})
+	if err != nil {
+		return fmt.Errorf("failed to list objects with prefix %s in %s: %w", prefix, r.Container, err)
+	}
+
+	// Bulk delete is an optional middleware, delete one by one so it works on every cluster
+	for _, name := range names {
+		err := r.Client.ObjectDelete(ctx, r.Container, name)
+		if err != nil && !errors.Is(err, swift.ObjectNotFound) {
+			return fmt.Errorf("failed to delete object %s from %s: %w", name, r.Container, err)
+		}
+	}
+	return nil
+}
+
+func (r *SwiftService) PresignGetObject(objectName string, expiry time.Duration) (string, error) {
+	return r.tempURL(objectName, "GET", expiry)
+}
+
+func (r *SwiftService) PresignPutObject(objectName string, expiry time.Duration) (string, error) {
+	return r.tempURL(objectName, "PUT", expiry)
+}
+
+func (r *SwiftService) tempURL(objectName, method string, expiry time.Duration) (string, error) {
+	if r.TempURLKey == "" {
+		return "", fmt.Errorf("failed to presign %s %s: missing temp URL key", method, objectName)
+	}
+
+	tempURL := r.Client.ObjectTempUrl(r.Container, objectName, r.TempURLKey, method, time.Now().Add(expiry))
+	if tempURL == "" {
+		return "", fmt.Errorf("failed to presign %s %s: connection is not authenticated", method, objectName)
+	}
+	return tempURL, nil
+}
+
+func (r *SwiftService) wrapError(objectName string, err error) error {
+	if errors.Is(err, swift.ObjectNotFound) {
+		return fmt.Errorf("%s: %w", objectName, ErrObjectNotFound)
+	}
+	return fmt.Errorf("object %s in %s: %w", objectName, r.Container, err)
+}
+
+func swiftObjectInfo(object swift.Object) ObjectInfo {
+	return ObjectInfo{
+		Key:          object.Name,
+		Size:         object.Bytes,
+		ContentType:  object.ContentType,
+		ETag:         object.Hash,
+		LastModified: object.LastModified,
+	}
+}
+
+// Swift has no native multipart upload, parts are uploaded as segments of a
+// Static Large Object and the manifest is written on completion.
+
+func (r *SwiftService) CreateMultipartUpload(objectName, contentType string) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to create multipart upload for %s: %w", objectName, err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func (r *SwiftService) PresignUploadPart(objectName, uploadID string, partNumber int, expiry time.Duration) (string, error) {
+	return r.tempURL(r.segmentName(objectName, uploadID, partNumber), "PUT", expiry)
+}
+
+func (r *SwiftService) CompleteMultipartUpload(objectName, uploadID string, totalParts int) error {
+	ctx := context.Background()
+
+	manifest := make([]swiftSegment, 0, totalParts)
+	for part := 1; part <= totalParts; part++ {
+		segmentName := r.segmentName(objectName, uploadID, part)
+		info, _, err := r.Client.Object(ctx, r.Container, segmentName)
+		if err != nil {
+			return fmt.Errorf("multipart upload of %s is missing part %d: %w", objectName, part, err)
+		}
+		manifest = append(manifest, swiftSegment{
+			Path: "/" + r.Container + "/" + segmentName,
+			Etag: info.Hash,
+			Size: info.Bytes,
+		})
+	}
+
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest of %s: %w", objectName, err)
+	}
+
+	_, _, err = r.Client.Call(ctx, r.Client.StorageUrl, swift.RequestOpts{
+		Container:  r.Container,
+		ObjectName: objectName,
+		Operation:  http.MethodPut,
+		Parameters: url.Values{"multipart-manifest": {"put"}},
+		Headers: swift.Headers{
+			"Content-Type":              ContentTypeFor(objectName),
+			"X-Object-Meta-Uploaded-By": r.Username,
+			"X-Object-Meta-Upload-Date": time.Now().UTC().Format(time.RFC3339),
+		},
+		Body:       bytes.NewReader(body),
+		NoResponse: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write manifest of %s: %w", objectName, err)
+	}
+	return nil
+}
+
+func (r *SwiftService) AbortMultipartUpload(objectName, uploadID string) error {
+	return r.DeletePrefix(r.segmentPrefix(objectName, uploadID))
+}
+
+type swiftSegment struct {
+	Path string `json:"path"`
+	Etag string `json:"etag"`
+	Size int64  `json:"size_bytes"`
+}
+
+// Segments live next to the object so deleting the video prefix removes them too
+func (r *SwiftService) segmentPrefix(objectName, uploadID string) string {
+	return objectName + ".segments/" + uploadID + "/"
+}
+
+func (r *SwiftService) segmentName(objectName, uploadID string, partNumber int) string {
+	return fmt.Sprintf("%s%08d", r.segmentPrefix(objectName, uploadID), partNumber)
+}
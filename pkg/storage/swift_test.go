@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestSwiftServiceContract runs against a real container when
+// TEST_SWIFT_AUTH_URL is set.
+func TestSwiftServiceContract(t *testing.T) {
+	authURL := os.Getenv("TEST_SWIFT_AUTH_URL")
+	if authURL == "" {
+		t.Skip("TEST_SWIFT_AUTH_URL is not set")
+	}
+
+	swift, err := NewSwiftService(os.Getenv("TEST_SWIFT_USERNAME"), os.Getenv("TEST_SWIFT_API_KEY"), authURL,
+		os.Getenv("TEST_SWIFT_REGION"), os.Getenv("TEST_SWIFT_CONTAINER"), os.Getenv("TEST_SWIFT_TEMP_URL_KEY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorageContract(t, swift, fmt.Sprintf("contract-test/%d/", time.Now().UnixNano()))
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Streaming formats that are usually missing from the system mime table
+var contentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".vtt":  "text/vtt",
+	".mpd":  "application/dash+xml",
+	".m4s":  "video/iso.segment",
+	".mp4":  "video/mp4",
+}
+
+// ContentTypeFor guesses the content type of an object from its extension.
+func ContentTypeFor(objectName string) string {
+	ext := strings.ToLower(filepath.Ext(objectName))
+	if contentType, ok := contentTypes[ext]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+func (o UploadOptions) contentType(objectName string) string {
+	if o.ContentType != "" {
+		return o.ContentType
+	}
+	return ContentTypeFor(objectName)
+}
+
+// UploadFile uploads the file at path to objectName.
+func UploadFile(s StorageService, objectName, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	return s.UploadObject(objectName, file, info.Size(), UploadOptions{})
+}
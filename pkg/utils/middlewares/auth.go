@@ -2,7 +2,9 @@ package middlewares
 
 import (
 	"net/http"
+	"slices"
 	"video-feed/config"
+	"video-feed/pkg/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -30,7 +32,7 @@ func isTokenValid(authHeader string, authUrl string) (bool, error) {
 func AuthMiddleware(cfg *config.AppConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
-		isValid, _ := isTokenValid(authHeader, "resr")
+		isValid, _ := isTokenValid(authHeader, cfg.Env.AUTH_URL)
 		if !isValid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
@@ -39,3 +41,16 @@ func AuthMiddleware(cfg *config.AppConfig) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// OperatorMiddleware only lets the users in OPERATOR_USER_IDS through, it
+// runs after AuthMiddleware.
+func OperatorMiddleware(cfg *config.AppConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(cfg.Env.OPERATOR_USER_IDS, utils.GetUserID(c)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,19 +1,34 @@
 package routes
 
 import (
+	"context"
 	"net/http"
 	"video-feed/config"
 	"video-feed/internal/controllers"
 	"video-feed/internal/repositories"
 	"video-feed/internal/services"
+	"video-feed/pkg/utils/middlewares"
 
 	"github.com/gin-gonic/gin"
 )
 
+// LocalStoragePath is where objects of the local storage provider are served.
+const LocalStoragePath = "/storage"
+
 func RegisterRoutes(router *gin.Engine, cfg *config.AppConfig) {
 	videoRepo := repositories.NewVideoRepository(cfg.DB)
-	videoService := services.NewVideoService(videoRepo, cfg.Storage, cfg)
+	jobRepo := repositories.NewTranscodeJobRepository(cfg.DB)
+	subtitleRepo := repositories.NewSubtitleRepository(cfg.DB)
+	keyRepo := repositories.NewVideoKeyRepository(cfg.DB)
+
+	hlsJob := services.NewHLSBackgroundJob(cfg, cfg.Storage, videoRepo, subtitleRepo, keyRepo, jobRepo, services.NewFFmpegTranscoder())
+	workerPool := services.NewTranscodeWorkerPool(cfg, jobRepo, cfg.Storage, hlsJob)
+	workerPool.Start(context.Background())
+
+	videoService := services.NewVideoService(videoRepo, subtitleRepo, cfg.Storage, cfg, workerPool)
 	videoController := controllers.NewVideoController(videoService)
+	jobController := controllers.NewTranscodeJobController(workerPool)
+	keyController := controllers.NewKeyController(services.NewKeyService(keyRepo, videoRepo))
 
 	api := router.Group("/api")
 	api.POST("/upload", videoController.UploadVideo)
@@ -21,9 +36,27 @@ func RegisterRoutes(router *gin.Engine, cfg *config.AppConfig) {
 	api.POST("/initiate-chunk-upload", videoController.InitiateChunkUpload)
 	api.POST("/upload-chunk", videoController.UploadChunk)
 	api.POST("/complete-chunk-upload", videoController.CompleteChunkUpload)
+	api.GET("/videos/:id/hls/*path", videoController.GetPlaylist)
+	api.GET("/videos/:id/status", videoController.GetStatus)
+	api.GET("/videos/:id/status/stream", videoController.StreamStatus)
+	api.POST("/videos/:id/cancel-processing", videoController.CancelProcessing)
+	api.GET("/videos/:id/subtitles", videoController.ListSubtitles)
+	api.POST("/videos/:id/subtitles", videoController.UploadSubtitle)
+	api.DELETE("/videos/:id/subtitles/:language", videoController.DeleteSubtitle)
+
+	jobs := api.Group("/transcode-jobs", middlewares.AuthMiddleware(cfg), middlewares.OperatorMiddleware(cfg))
+	jobs.GET("", jobController.ListJobs)
+	jobs.POST("/:id/retry", jobController.RetryJob)
+
+	api.GET("/keys/:videoID", middlewares.AuthMiddleware(cfg), keyController.GetKey)
 
 	// api.Use(middlewares.AuthMiddleware())
 
+	// Serve objects written by the local storage provider, CDN_URL should point here
+	if cfg.Env.STORAGE_PROVIDER == "local" {
+		router.Static(LocalStoragePath, cfg.Env.LOCAL_STORAGE_ROOT)
+	}
+
 	web := router.Group("/web")
 
 	// Route untuk serve HTML
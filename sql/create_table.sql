@@ -1,13 +1,97 @@
-CREATE TABLE videos (
+CREATE TABLE IF NOT EXISTS videos (
     id VARCHAR(255) PRIMARY KEY,
     user_id VARCHAR(255) NOT NULL,
     original_url TEXT,
     hls_url TEXT,
+    dash_url TEXT DEFAULT '',
     thumbnail_url TEXT,
+    sprite_vtt_url TEXT DEFAULT '', -- WebVTT track of trick-play sprite sheets
     duration FLOAT,
     description TEXT,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     qualities JSONB DEFAULT '[]'::JSONB, -- Simpan kualitas sebagai array JSON
     hls_processed BOOLEAN DEFAULT FALSE,
-    processing_error TEXT
+    playable BOOLEAN DEFAULT FALSE, -- At least one rendition is published
+    renditions JSONB DEFAULT '{}'::JSONB, -- Rung name to pending, encoding or ready
+    processing_error TEXT,
+    -- Probed from the original with ffprobe
+    width INT DEFAULT 0,
+    height INT DEFAULT 0,
+    frame_rate FLOAT DEFAULT 0,
+    video_codec VARCHAR(64) DEFAULT '',
+    audio_codec VARCHAR(64) DEFAULT '',
+    rotation INT DEFAULT 0,
+    bitrate BIGINT DEFAULT 0,
+    container_format VARCHAR(255) DEFAULT '',
+    cancelled_at TIMESTAMP WITH TIME ZONE -- Processing was cancelled by the owner
 );
+
+CREATE TABLE IF NOT EXISTS transcode_jobs (
+    id VARCHAR(255) PRIMARY KEY,
+    video_id VARCHAR(255) NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    input_path TEXT NOT NULL, -- Object key of the original upload
+    state VARCHAR(32) NOT NULL DEFAULT 'queued', -- queued, running, succeeded, failed, dead, cancelled
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5,
+    next_run_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP, -- Retry backoff, not claimed before this
+    error TEXT,
+    error_history JSONB DEFAULT '[]'::JSONB, -- One entry per failed attempt
+    progress JSONB DEFAULT '{}'::JSONB, -- Percent and ETA of the current attempt by rendition
+    ladder JSONB, -- Encoding ladder the current attempt picked, with its analysis
+    worker_id VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    heartbeat_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS subtitles (
+    id VARCHAR(255) PRIMARY KEY,
+    video_id VARCHAR(255) NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    language VARCHAR(35) NOT NULL, -- BCP 47 tag like en or pt-BR
+    label TEXT NOT NULL,
+    vtt_url TEXT NOT NULL, -- Object key of the WebVTT file
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (video_id, language)
+);
+
+-- AES-128 keys of encrypted HLS videos, never written to the bucket
+CREATE TABLE IF NOT EXISTS video_keys (
+    video_id VARCHAR(255) NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+    key_index INT NOT NULL, -- Rotation period, segments use key floor(n / HLS_KEY_ROTATION)
+    key_data BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (video_id, key_index)
+);
+
+-- Upgrade tables created by earlier versions, the file can be run again on
+-- an existing database
+ALTER TABLE videos
+    ADD COLUMN IF NOT EXISTS dash_url TEXT DEFAULT '',
+    ADD COLUMN IF NOT EXISTS sprite_vtt_url TEXT DEFAULT '',
+    ADD COLUMN IF NOT EXISTS playable BOOLEAN DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS renditions JSONB DEFAULT '{}'::JSONB,
+    ADD COLUMN IF NOT EXISTS width INT DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS height INT DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS frame_rate FLOAT DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS video_codec VARCHAR(64) DEFAULT '',
+    ADD COLUMN IF NOT EXISTS audio_codec VARCHAR(64) DEFAULT '',
+    ADD COLUMN IF NOT EXISTS rotation INT DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS bitrate BIGINT DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS container_format VARCHAR(255) DEFAULT '',
+    ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE transcode_jobs
+    ADD COLUMN IF NOT EXISTS max_attempts INT NOT NULL DEFAULT 5,
+    ADD COLUMN IF NOT EXISTS next_run_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS error_history JSONB DEFAULT '[]'::JSONB,
+    ADD COLUMN IF NOT EXISTS progress JSONB DEFAULT '{}'::JSONB,
+    ADD COLUMN IF NOT EXISTS ladder JSONB;
+
+CREATE INDEX IF NOT EXISTS transcode_jobs_state_idx ON transcode_jobs (state, next_run_at);
+
+-- The feed only lists playable videos, processed ones were playable before the column existed
+UPDATE videos
+SET playable = TRUE
+WHERE NOT playable AND (hls_processed OR COALESCE(hls_url, '') <> '');